@@ -1,35 +1,87 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/philangist/apollo/mixer"
 )
 
+const DEFAULT_JOURNAL = "apollo.journal"
+
 type CLI struct{}
 
+// Options is a batch as described on the command line
+type Options struct {
+	Amount        mixer.Coin
+	Timeout       int
+	Destinations  []mixer.Destination
+	Network       *mixer.Network
+	Journal       string
+	Strategy      mixer.PayoutStrategy
+	Denominations *mixer.Denominations
+}
+
 func (cli *CLI) Usage() {
 	fmt.Println("Usage:")
-	fmt.Println("   --amount AMOUNT --destination \"ADDRESS1 ADDRESS2 ...ADDRESSN\" --timeout TIMEOUT - Send AMOUNT of Jobcoins to ADDRESSES that you own")
+	fmt.Println("   --amount AMOUNT --destination \"ADDRESS1[:WEIGHT|=AMOUNT] ADDRESS2 ...ADDRESSN\" --timeout TIMEOUT [--strategy NAME [--minimum AMOUNT]] [--denominations AMOUNTS [--remainder fee|change]] [--network NAME] [--ledger URL] - Send AMOUNT of Jobcoins to ADDRESSES that you own")
+	fmt.Println("   resume [--journal FILE] [--network NAME] [--ledger URL] - Finish the unfinished batches recorded in FILE")
+	fmt.Println("   jobcoind [--listen ADDRESS] [--data FILE] - Run a local Jobcoin server that stores its ledger in FILE")
 }
 
-func (cli *CLI) Parse() (mixer.Coin, int, []mixer.Address) {
+func (cli *CLI) Parse() *Options {
 	amount := flag.String("amount", "", "amount of Jobcoin to tumble")
 	timeout := flag.Int("timeout", 60, "number of seconds to watch for inbound transfer to tumbler address")
-	destination := flag.String("destination", "", "amount of Jobcoin to tumble")
+	destination := flag.String("destination", "", "space separated addresses to send to, each optionally followed by :WEIGHT or =AMOUNT")
+	networkName := flag.String("network", mixer.DEFAULT_NETWORK, fmt.Sprintf("Jobcoin network profile to use, one of: %s", strings.Join(mixer.NetworkNames(), ", ")))
+	ledgerURL := flag.String("ledger", "", "base url of a Jobcoin server to use instead of the network's default, e.g. http://localhost:8080")
+	journal := flag.String("journal", DEFAULT_JOURNAL, "file batches are recorded in so they can be resumed after a crash")
+	strategyName := flag.String("strategy", mixer.DEFAULT_STRATEGY, fmt.Sprintf("how the amount is split between destinations, one of: %s", strings.Join(mixer.PayoutStrategyNames(), ", ")))
+	minimum := flag.String("minimum", "0.01", "smallest payout each destination gets with the minimum strategy")
+	denominations := flag.String("denominations", "", "comma separated amounts to make every payout in, e.g. 0.01,0.1,1,10")
+	remainder := flag.String("remainder", mixer.DEFAULT_REMAINDER, fmt.Sprintf("what to do with the part of a payout smaller than every denomination, '%s' or '%s'", mixer.REMAINDER_FEE, mixer.REMAINDER_CHANGE))
 
 	flag.Parse()
 
-	parsedAmount, err := mixer.CoinFromString(*amount)
+	network := cli.network(*networkName, *ledgerURL)
+
+	parsedAmount, err := mixer.ParseCoin(*amount, network.Precision)
 	if err != nil {
-		fmt.Println(fmt.Errorf("Amount '%v' is not a valid numeric value", amount))
+		fmt.Println(err)
 		cli.Usage()
 		os.Exit(1)
 	}
 
+	parsedMinimum, err := mixer.ParseCoin(*minimum, network.Precision)
+	if err != nil {
+		fmt.Println(err)
+		cli.Usage()
+		os.Exit(1)
+	}
+
+	strategy, err := mixer.NewPayoutStrategy(*strategyName, parsedMinimum)
+	if err != nil {
+		fmt.Println(err)
+		cli.Usage()
+		os.Exit(1)
+	}
+
+	var parsedDenominations *mixer.Denominations
+	if *denominations != "" {
+		parsedDenominations, err = mixer.ParseDenominations(*denominations, network.Precision, *remainder)
+		if err != nil {
+			fmt.Println(err)
+			cli.Usage()
+			os.Exit(1)
+		}
+	}
+
 	if parsedAmount < 0 {
 		fmt.Println("Amount must be a non-negative value")
 		cli.Usage()
@@ -47,31 +99,138 @@ func (cli *CLI) Parse() (mixer.Coin, int, []mixer.Address) {
 		os.Exit(1)
 	}
 
-	var addresses []mixer.Address
-	for _, address := range strings.Split(*destination, " ") {
-		if address == "" {
+	var destinations []mixer.Destination
+	for _, entry := range strings.Split(*destination, " ") {
+		if entry == "" {
 			continue
 		}
-		addresses = append(addresses, mixer.Address(address))
+		parsed, err := mixer.ParseDestination(entry, network.Precision)
+		if err != nil {
+			fmt.Println(err)
+			cli.Usage()
+			os.Exit(1)
+		}
+		destinations = append(destinations, parsed)
 	}
-	if len(addresses) == 0 {
+	if len(destinations) == 0 {
 		fmt.Println("No valid addresses seen. Addresses must be non-empty strings")
 		cli.Usage()
 		os.Exit(1)
 	}
 
-	return parsedAmount, *timeout, addresses
+	return &Options{parsedAmount, *timeout, destinations, network, *journal, strategy, parsedDenominations}
+}
+
+func (cli *CLI) network(name, ledgerURL string) *mixer.Network {
+	network, err := mixer.NewNetwork(name)
+	if err != nil {
+		fmt.Println(err)
+		cli.Usage()
+		os.Exit(1)
+	}
+	if ledgerURL != "" {
+		network = network.WithBaseURL(ledgerURL)
+	}
+	return network
+}
+
+// openMixer returns a mixer for network that records its batches in journalPath,
+// with any unfinished batches from a previous run already added
+func (cli *CLI) openMixer(network *mixer.Network, journalPath string) (*mixer.Mixer, *mixer.RateLimiter) {
+	client := mixer.NewApiClient()
+	ledger := mixer.NewJobcoinLedger(client, network)
+
+	journal, err := mixer.OpenJournal(journalPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	m := mixer.NewMixer(ledger, nil)
+	m.Journal = journal
+	_, err = m.Resume()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return m, client.Limiter
+}
+
+// run blocks until every batch of m is done, stopping polling and payouts cleanly on ctrl-c
+func (cli *CLI) run(m *mixer.Mixer, limiter *mixer.RateLimiter) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	m.RunContext(ctx)
+	m.Journal.Close()
+
+	budget := limiter.Budget()
+	fmt.Printf("Ledger requests made: %d reads, %d sends\n", budget.ReadsUsed, budget.SendsUsed)
+}
+
+func (cli *CLI) RunResume(args []string) {
+	flags := flag.NewFlagSet("resume", flag.ExitOnError)
+	journal := flags.String("journal", DEFAULT_JOURNAL, "file batches were recorded in")
+	networkName := flags.String("network", mixer.DEFAULT_NETWORK, "Jobcoin network profile the batches were made on")
+	ledgerURL := flags.String("ledger", "", "base url of a Jobcoin server to use instead of the network's default")
+	flags.Parse(args)
+
+	m, limiter := cli.openMixer(cli.network(*networkName, *ledgerURL), *journal)
+	if len(m.Batches) == 0 {
+		fmt.Printf("No unfinished batches in '%s'\n", *journal)
+		return
+	}
+	cli.run(m, limiter)
+}
+
+func (cli *CLI) RunJobcoind(args []string) {
+	flags := flag.NewFlagSet("jobcoind", flag.ExitOnError)
+	listen := flags.String("listen", "localhost:8080", "address to serve the Jobcoin API on")
+	data := flags.String("data", "jobcoind.json", "file the ledger is persisted to")
+	flags.Parse(args)
+
+	sim, err := mixer.LoadSimulator(*data)
+	if err != nil {
+		fmt.Println(err)
+		cli.Usage()
+		os.Exit(1)
+	}
+
+	fmt.Printf("Serving Jobcoin API on http://%s with ledger '%s'\n", *listen, *data)
+	fmt.Printf("Mint coins with: curl -d '{\"toAddress\":\"Alice\",\"amount\":\"50\"}' http://%s%s\n", *listen, mixer.SIMULATOR_FAUCET_PATH)
+	log.Fatal(http.ListenAndServe(*listen, sim))
 }
 
 func main() {
 	cli := &CLI{}
-	amount, timeout, recipients := cli.Parse()
+	if len(os.Args) > 1 && os.Args[1] == "jobcoind" {
+		cli.RunJobcoind(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "resume" {
+		cli.RunResume(os.Args[2:])
+		return
+	}
+
+	options := cli.Parse()
+	network := options.Network
+	m, limiter := cli.openMixer(network, options.Journal)
+	m.Denominations = options.Denominations
 
-	fee := mixer.Coin(int64(float64(amount) * float64(0.2)))
-	source := mixer.NewWallet(mixer.NewAddresses(1)[0])
-	fmt.Printf("Send %v Jobcoins to tumbler address: %s\n", amount.ToString(), source.Address)
+	// the fee comes from the mixer's fee schedule for the network's asset
+	source := mixer.NewWallet(m.Ledger, mixer.NewAddresses(1)[0])
+	_, err := m.NewBatch(source, mixer.NewAmount(options.Amount, network.Asset, network.Precision), options.Destinations, options.Timeout, options.Strategy)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Send %v %s to tumbler address: %s\n", options.Amount.Format(network.Precision), network.Asset, source.Address)
 
-	batch := mixer.NewBatch(amount, fee, source, recipients, timeout)
-	mixer := mixer.NewMixer([]*mixer.Batch{batch})
-	mixer.Run()
+	cli.run(m, limiter)
 }
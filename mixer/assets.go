@@ -0,0 +1,94 @@
+package mixer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Asset names a kind of coin. Each Network carries a single asset, so an Apollo
+// deployment mixes several assets by talking to one ledger per asset
+type Asset string
+
+const DEFAULT_ASSET Asset = "JBC"
+
+// the share of each batch kept in the pool, unless a Mixer is given another FeeSchedule
+const DEFAULT_FEE_PERCENT = 20
+
+var ErrAssetMismatch = errors.New("Asset Mismatch")
+
+// Amount is a Coin tagged with the asset it's denominated in, and the number of decimal
+// places that asset's coins have
+type Amount struct {
+	Value     Coin
+	Asset     Asset
+	Precision int
+}
+
+func NewAmount(value Coin, asset Asset, precision int) Amount {
+	return Amount{value, asset, precision}
+}
+
+func (a Amount) String() string {
+	return fmt.Sprintf("%s %s", a.Value.Format(a.Precision), a.Asset)
+}
+
+// assetLedger is implemented by ledgers that know which asset they hold
+type assetLedger interface {
+	Asset() Asset
+}
+
+// AssetOf returns the asset held by ledger, DEFAULT_ASSET if it doesn't say
+func AssetOf(ledger Ledger) Asset {
+	if ledger, ok := ledger.(assetLedger); ok && ledger.Asset() != "" {
+		return ledger.Asset()
+	}
+	return DEFAULT_ASSET
+}
+
+// precisionLedger is implemented by ledgers that know how many decimal places their
+// coins have
+type precisionLedger interface {
+	Precision() int
+}
+
+// PrecisionOf returns the precision of ledger's coins, DEFAULT_PRECISION if it doesn't say
+func PrecisionOf(ledger Ledger) int {
+	if ledger, ok := ledger.(precisionLedger); ok {
+		return ledger.Precision()
+	}
+	return DEFAULT_PRECISION
+}
+
+// FeeSchedule returns the fee a Mixer keeps from a batch of amount
+type FeeSchedule func(amount Coin) (Coin, error)
+
+// PercentFee keeps percent of every batch
+func PercentFee(percent int64) FeeSchedule {
+	return func(amount Coin) (Coin, error) {
+		if percent < 0 || percent > 100 {
+			return 0, fmt.Errorf("Fee of %d%% is not between 0 and 100", percent)
+		}
+		return amount.Percent(percent)
+	}
+}
+
+// AssetConfig is how a Mixer handles one asset: the ledger it lives on, the pool its
+// deposits are gathered in, the fee taken from them and the denominations, if any,
+// they're paid out in
+type AssetConfig struct {
+	Ledger        Ledger
+	Pool          PoolStrategy
+	Fee           FeeSchedule
+	Watcher       *Watcher
+	Denominations *Denominations
+}
+
+func NewAssetConfig(ledger Ledger, pool PoolStrategy, fee FeeSchedule) *AssetConfig {
+	return &AssetConfig{
+		ledger,
+		pool,
+		fee,
+		NewWatcher(ledger),
+		nil,
+	}
+}
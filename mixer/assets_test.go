@@ -0,0 +1,130 @@
+package mixer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMixerNewBatchAssets(t *testing.T) {
+	fmt.Println("Running TestMixerNewBatchAssets...")
+
+	jobcoin := NewJobcoinLedger(NewApiClient(), VictoryNetwork())
+	gold := LocalNetwork()
+	gold.Asset = "GLD"
+	goldLedger := NewJobcoinLedger(NewApiClient(), gold)
+
+	mixer := NewMixer(jobcoin, nil)
+	mixer.AddAsset("GLD", NewAssetConfig(goldLedger, HourlyPool, PercentFee(10)))
+
+	batch, err := mixer.NewBatch(NewWallet(jobcoin, "Tumbler-1"), NewAmount(Coin(1000), DEFAULT_ASSET, DEFAULT_PRECISION), NewDestinations([]Address{"Bob"}), 1, HalvingStrategy{})
+	if err != nil || batch.Fee != Coin(200) || batch.Asset != DEFAULT_ASSET {
+		t.Errorf("Expected a %s batch with the default fee of 2.00, saw %v and error %v", DEFAULT_ASSET, batch, err)
+	}
+
+	batch, err = mixer.NewBatch(NewWallet(goldLedger, "Tumbler-2"), NewAmount(Coin(1000), "GLD", DEFAULT_PRECISION), NewDestinations([]Address{"Bob"}), 1, HalvingStrategy{})
+	if err != nil || batch.Fee != Coin(100) || batch.Asset != "GLD" {
+		t.Errorf("Expected a GLD batch with a fee of 1.00, saw %v and error %v", batch, err)
+	}
+
+	_, err = mixer.NewBatch(NewWallet(goldLedger, "Tumbler-3"), NewAmount(Coin(1000), DEFAULT_ASSET, DEFAULT_PRECISION), NewDestinations([]Address{"Bob"}), 1, HalvingStrategy{})
+	if !errors.Is(err, ErrAssetMismatch) {
+		t.Errorf("Expected tumbling %s through a GLD wallet to fail with ErrAssetMismatch, saw %v", DEFAULT_ASSET, err)
+	}
+
+	silver := LocalNetwork()
+	silver.Asset = "SLV"
+	_, err = mixer.NewBatch(NewWallet(NewJobcoinLedger(NewApiClient(), silver), "Tumbler-4"), NewAmount(Coin(1000), "SLV", DEFAULT_PRECISION), NewDestinations([]Address{"Bob"}), 1, HalvingStrategy{})
+	if !errors.Is(err, ErrAssetMismatch) {
+		t.Errorf("Expected an unconfigured asset to fail with ErrAssetMismatch, saw %v", err)
+	}
+
+	if len(mixer.Batches) != 2 {
+		t.Errorf("Expected only the 2 valid batches to be added, saw %d", len(mixer.Batches))
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	fmt.Println("Running TestAmountString...")
+
+	cases := []struct {
+		amount   Amount
+		expected string
+	}{
+		{NewAmount(Coin(1000), DEFAULT_ASSET, DEFAULT_PRECISION), "10.00 JBC"},
+		{NewAmount(Coin(5), "GLD", 0), "5 GLD"},
+		{NewAmount(Coin(12345678), "SAT", 8), "0.12345678 SAT"},
+	}
+	for _, c := range cases {
+		if c.amount.String() != c.expected {
+			t.Errorf("Expected %s, saw %s", c.expected, c.amount)
+		}
+	}
+}
+
+func TestDepositTrackerRejectsOtherAssets(t *testing.T) {
+	fmt.Println("Running TestDepositTrackerRejectsOtherAssets...")
+
+	tracker := NewDepositTracker("Tumbler", "GLD", time.Now())
+	deposits := tracker.Track([]*Transaction{
+		&Transaction{time.Now(), "Alice", "Tumbler", Coin(100), DEFAULT_ASSET, 0},
+		&Transaction{time.Now(), "Alice", "Tumbler", Coin(200), "GLD", 0},
+	})
+
+	if len(deposits) != 1 || deposits[0].Amount != Coin(200) {
+		t.Errorf("Expected only the GLD deposit to be credited, saw %v", deposits)
+	}
+}
+
+func TestMixerRunMultipleAssets(t *testing.T) {
+	fmt.Println("Running TestMixerRunMultipleAssets...")
+
+	amount := Coin(1000)
+	assets := []Asset{DEFAULT_ASSET, "GLD"}
+	fees := map[Asset]int64{DEFAULT_ASSET: 20, "GLD": 5}
+	sims := map[Asset]*Simulator{}
+	var mixer *Mixer
+
+	for _, asset := range assets {
+		sim := NewSimulator()
+		_, server := newSimulatedLedger(sim)
+		defer server.Close()
+
+		network := LocalNetwork().WithBaseURL(server.URL)
+		network.Asset = asset
+		ledger := NewJobcoinLedger(NewApiClient(), network)
+		if mixer == nil {
+			mixer = NewMixer(ledger, nil)
+		}
+
+		config := NewAssetConfig(ledger, func(ledger Ledger) *Wallet {
+			return NewWallet(ledger, "Pool")
+		}, PercentFee(fees[asset]))
+		config.Watcher.PollInterval = time.Duration(10) * time.Millisecond
+		mixer.AddAsset(asset, config)
+
+		source := NewWallet(ledger, NewAddresses(1)[0])
+		batch, err := mixer.NewBatch(source, NewAmount(amount, asset, DEFAULT_PRECISION), NewDestinations(NewAddresses(2)), 5, HalvingStrategy{})
+		if err != nil {
+			t.Fatalf("Mixer.NewBatch returned unexpected error %s", err)
+		}
+		batch.DelayGenerator = func(maxDelay int) int {
+			return 0
+		}
+
+		sim.Mint("Alice", amount)
+		sim.Send("Alice", source.Address, amount)
+		sims[asset] = sim
+	}
+
+	mixer.Run()
+
+	// each asset's fee stays in that asset's own pool
+	for _, asset := range assets {
+		expected := amount * Coin(fees[asset]) / 100
+		if balance := sims[asset].Balance("Pool"); balance != expected {
+			t.Errorf("Expected the %s pool to keep %v, saw %v", asset, expected.ToString(), balance.ToString())
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package mixer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// Interaction is a single request made to a ledger and what came back. Err is set
+// instead of Response when the request failed. A response that isn't JSON, like an
+// error page from a proxy, is kept as a string in RawResponse instead
+type Interaction struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	ContentType string          `json:"contentType,omitempty"`
+	Body        string          `json:"body,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	RawResponse *string         `json:"rawResponse,omitempty"`
+	Err         *RecordedError  `json:"error,omitempty"`
+}
+
+// RecordedError is enough of an error to rebuild it on replay. LedgerErrors keep their
+// status code and message so they're classified the same way again
+type RecordedError struct {
+	StatusCode int    `json:"statusCode,omitempty"`
+	Message    string `json:"message"`
+}
+
+func recordError(err error) *RecordedError {
+	if err == nil {
+		return nil
+	}
+
+	var ledgerErr *LedgerError
+	if errors.As(err, &ledgerErr) {
+		return &RecordedError{ledgerErr.StatusCode, ledgerErr.Message}
+	}
+	return &RecordedError{0, err.Error()}
+}
+
+func (e *RecordedError) replay(method, url string) error {
+	if e == nil {
+		return nil
+	}
+	if e.StatusCode != 0 {
+		return classifyLedgerError(method, url, e.StatusCode, e.Message)
+	}
+	return errors.New(e.Message)
+}
+
+// Cassette is an ordered list of Interactions stored as a JSON file
+type Cassette struct {
+	mutex        sync.Mutex
+	path         string
+	Interactions []*Interaction
+}
+
+func NewCassette(path string) *Cassette {
+	return &Cassette{path: path}
+}
+
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCassette(path)
+	err = json.Unmarshal(b, &c.Interactions)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse cassette '%s': %s", path, err)
+	}
+	return c, nil
+}
+
+// Append records interaction and rewrites the cassette file, so a session that's
+// interrupted still leaves everything up to that point on disk
+func (c *Cassette) Append(interaction *Interaction) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.Interactions = append(c.Interactions, interaction)
+
+	b, err := json.MarshalIndent(c.Interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, b)
+}
+
+// RecordingClient passes every request through to client and records the exchange on
+// a Cassette. Failed requests are recorded too, along with their error
+type RecordingClient struct {
+	client   JSONClient
+	Cassette *Cassette
+}
+
+func NewRecordingClient(client JSONClient, path string) *RecordingClient {
+	return &RecordingClient{
+		client,
+		NewCassette(path),
+	}
+}
+
+func (r *RecordingClient) JSONGetRequest(url string) ([]byte, error) {
+	return r.JSONGetRequestContext(context.Background(), url)
+}
+
+func (r *RecordingClient) JSONGetRequestContext(ctx context.Context, url string) ([]byte, error) {
+	byteStream, err := getContext(ctx, r.client, url)
+
+	interaction := &Interaction{Method: "GET", URL: url, Err: recordError(err)}
+	if err == nil && json.Valid(byteStream) {
+		interaction.Response = json.RawMessage(byteStream)
+	} else if err == nil {
+		raw := string(byteStream)
+		interaction.RawResponse = &raw
+	}
+	if recordErr := r.Cassette.Append(interaction); recordErr != nil {
+		return byteStream, fmt.Errorf("Could not record request to url '%s': %s", url, recordErr)
+	}
+	return byteStream, err
+}
+
+func (r *RecordingClient) JSONPostRequest(url string, payload *bytes.Buffer) error {
+	return r.JSONPostRequestContext(context.Background(), url, payload)
+}
+
+func (r *RecordingClient) JSONPostRequestContext(ctx context.Context, url string, payload *bytes.Buffer) error {
+	return r.PostRequestContext(ctx, url, CONTENT_TYPE_JSON, payload)
+}
+
+func (r *RecordingClient) PostRequestContext(ctx context.Context, url, contentType string, payload *bytes.Buffer) error {
+	// copy the body before the wrapped client gets a chance to read it
+	body := payload.String()
+	err := postContext(ctx, r.client, url, contentType, payload)
+
+	interaction := &Interaction{
+		Method:      "POST",
+		URL:         url,
+		ContentType: contentType,
+		Body:        body,
+		Err:         recordError(err),
+	}
+	if recordErr := r.Cassette.Append(interaction); recordErr != nil {
+		return fmt.Errorf("Could not record request to url '%s': %s", url, recordErr)
+	}
+	return err
+}
+
+// ReplayingClient serves the Interactions on a Cassette back in the order they were
+// recorded. Every request has to match the next interaction exactly, method, url,
+// content type and body included, otherwise it fails without consuming it
+type ReplayingClient struct {
+	mutex    sync.Mutex
+	cassette *Cassette
+	next     int
+}
+
+func NewReplayingClient(cassette *Cassette) *ReplayingClient {
+	return &ReplayingClient{cassette: cassette}
+}
+
+func LoadReplayingClient(path string) (*ReplayingClient, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayingClient(cassette), nil
+}
+
+// Remaining is the number of recorded interactions that haven't been replayed yet
+func (r *ReplayingClient) Remaining() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return len(r.cassette.Interactions) - r.next
+}
+
+func (r *ReplayingClient) replay(ctx context.Context, request *Interaction) (*Interaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.next >= len(r.cassette.Interactions) {
+		return nil, fmt.Errorf(
+			"Unexpected %s request to url '%s', all %d recorded interactions have been replayed",
+			request.Method, request.URL, len(r.cassette.Interactions))
+	}
+
+	expected := r.cassette.Interactions[r.next]
+	if expected.Method != request.Method || expected.URL != request.URL ||
+		expected.ContentType != request.ContentType || expected.Body != request.Body {
+		return nil, fmt.Errorf(
+			"Interaction %d doesn't match: expected %s '%s' with body '%s', saw %s '%s' with body '%s'",
+			r.next, expected.Method, expected.URL, expected.Body, request.Method, request.URL, request.Body)
+	}
+
+	r.next += 1
+	return expected, nil
+}
+
+func (r *ReplayingClient) JSONGetRequest(url string) ([]byte, error) {
+	return r.JSONGetRequestContext(context.Background(), url)
+}
+
+func (r *ReplayingClient) JSONGetRequestContext(ctx context.Context, url string) ([]byte, error) {
+	interaction, err := r.replay(ctx, &Interaction{Method: "GET", URL: url})
+	if err != nil {
+		return nil, err
+	}
+	if interaction.Err != nil {
+		return nil, interaction.Err.replay("GET", url)
+	}
+	if interaction.RawResponse != nil {
+		return []byte(*interaction.RawResponse), nil
+	}
+	return []byte(interaction.Response), nil
+}
+
+func (r *ReplayingClient) JSONPostRequest(url string, payload *bytes.Buffer) error {
+	return r.JSONPostRequestContext(context.Background(), url, payload)
+}
+
+func (r *ReplayingClient) JSONPostRequestContext(ctx context.Context, url string, payload *bytes.Buffer) error {
+	return r.PostRequestContext(ctx, url, CONTENT_TYPE_JSON, payload)
+}
+
+func (r *ReplayingClient) PostRequestContext(ctx context.Context, url, contentType string, payload *bytes.Buffer) error {
+	request := &Interaction{Method: "POST", URL: url, ContentType: contentType, Body: payload.String()}
+	interaction, err := r.replay(ctx, request)
+	if err != nil {
+		return err
+	}
+	return interaction.Err.replay("POST", url)
+}
@@ -0,0 +1,139 @@
+package mixer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// session runs the same handful of requests against whichever ledger it's given
+func session(ctx context.Context, ledger Ledger) ([]*Transaction, Coin, error, error) {
+	sendErr := ledger.SendTransaction(ctx, "Alice", "Bob", Coin(250))
+	overdrawErr := ledger.SendTransaction(ctx, "Bob", "Charles", Coin(1000))
+	txns, _ := ledger.GetTransactions(ctx)
+	balance, _ := ledger.GetBalance(ctx, "Bob")
+	return txns, balance, sendErr, overdrawErr
+}
+
+func TestRecordingClientReplay(t *testing.T) {
+	fmt.Println("Running TestRecordingClientReplay...")
+
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.json")
+
+	ctx := context.Background()
+	sim := NewSimulator()
+	sim.Mint("Alice", Coin(1000))
+	_, server := newSimulatedLedger(sim)
+	network := LocalNetwork().WithBaseURL(server.URL)
+
+	recorder := NewRecordingClient(NewApiClient(), path)
+	recordedTxns, recordedBalance, _, _ := session(ctx, NewJobcoinLedger(recorder, network))
+	server.Close()
+
+	client, err := LoadReplayingClient(path)
+	if err != nil {
+		t.Fatalf("LoadReplayingClient returned unexpected error %s", err)
+	}
+
+	// the server is gone, everything below is served from the cassette
+	txns, balance, sendErr, overdrawErr := session(ctx, NewJobcoinLedger(client, network))
+	if sendErr != nil {
+		t.Errorf("Replayed send returned unexpected error %s", sendErr)
+	}
+	if !errors.Is(overdrawErr, ErrInsufficientFunds) {
+		t.Errorf("Expected replayed overdraw to return ErrInsufficientFunds, saw %v", overdrawErr)
+	}
+	if len(txns) != len(recordedTxns) || balance != recordedBalance || balance != Coin(250) {
+		t.Errorf("Expected replay to return %v and %v, saw %v and %v", recordedTxns, recordedBalance, txns, balance)
+	}
+	if client.Remaining() != 0 {
+		t.Errorf("Expected every interaction to be replayed, %d remain", client.Remaining())
+	}
+}
+
+func TestReplayingClientStrictMatching(t *testing.T) {
+	fmt.Println("Running TestReplayingClientStrictMatching...")
+
+	url := "http://ledger/send"
+	cassette := NewCassette("")
+	cassette.Interactions = []*Interaction{
+		&Interaction{Method: "POST", URL: url, ContentType: CONTENT_TYPE_JSON, Body: `{"amount":"1.00"}`},
+		&Interaction{Method: "GET", URL: "http://ledger/api/transactions", Response: []byte("[]")},
+	}
+	client := NewReplayingClient(cassette)
+
+	// requests out of order, or with a different body, don't match and aren't consumed
+	_, err := client.JSONGetRequest("http://ledger/api/transactions")
+	if err == nil {
+		t.Errorf("Expected an out of order request to fail")
+	}
+	err = client.JSONPostRequest(url, bytes.NewBufferString(`{"amount":"2.00"}`))
+	if err == nil {
+		t.Errorf("Expected a request with a different body to fail")
+	}
+	if client.Remaining() != 2 {
+		t.Errorf("Expected mismatched requests not to consume interactions, %d remain", client.Remaining())
+	}
+
+	err = client.JSONPostRequest(url, bytes.NewBufferString(`{"amount":"1.00"}`))
+	if err != nil {
+		t.Errorf("Matching request returned unexpected error %s", err)
+	}
+	b, err := client.JSONGetRequest("http://ledger/api/transactions")
+	if err != nil || string(b) != "[]" {
+		t.Errorf("Expected recorded response '[]', saw '%s' and error %v", b, err)
+	}
+
+	_, err = client.JSONGetRequest("http://ledger/api/transactions")
+	if err == nil {
+		t.Errorf("Expected a request past the end of the cassette to fail")
+	}
+}
+
+// a response that isn't JSON is recorded as is and replayed byte for byte
+func TestRecordingClientNonJSONResponse(t *testing.T) {
+	fmt.Println("Running TestRecordingClientNonJSONResponse...")
+
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.json")
+
+	bodies := []string{"<html><body>502 Bad Gateway</body></html>\n", ""}
+	calls := 0
+	recorder := NewRecordingClient(&testClient{
+		GetResponse: func(url string) ([]byte, error) {
+			calls += 1
+			return []byte(bodies[calls-1]), nil
+		},
+	}, path)
+	for _, body := range bodies {
+		recorded, err := recorder.JSONGetRequest("/api/transactions")
+		if err != nil || string(recorded) != body {
+			t.Fatalf("Expected %q to be passed through, saw %q and error %v", body, recorded, err)
+		}
+	}
+
+	client, err := LoadReplayingClient(path)
+	if err != nil {
+		t.Fatalf("LoadReplayingClient returned unexpected error %s", err)
+	}
+	for _, body := range bodies {
+		replayed, err := client.JSONGetRequest("/api/transactions")
+		if err != nil || string(replayed) != body {
+			t.Errorf("Expected %q to be replayed, saw %q and error %v", body, replayed, err)
+		}
+	}
+}
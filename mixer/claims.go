@@ -0,0 +1,138 @@
+package mixer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// transfer is a send that's looked for on the ledger: amount from one address to
+// another, made no earlier than after
+type transfer struct {
+	id     string
+	from   Address
+	to     Address
+	amount Coin
+	after  time.Time
+}
+
+func (t transfer) matches(txn *Transaction) bool {
+	return txn.Source == t.from && txn.Recipient == t.to && txn.Amount == t.amount && txn.Timestamp.After(t.after)
+}
+
+// Claims keeps track of which ledger transaction confirmed which send, for every batch
+// of a Mixer, since batches share their pool and can send identical payouts out of it.
+// A transaction confirms a single send. Sends that are known to have been made but
+// aren't confirmed yet are outstanding: they're certainly on the ledger, so they get
+// first pick of the transactions that fit them over sends that only may have been made
+type Claims struct {
+	mutex       sync.Mutex
+	claimed     map[Address]map[string]string // pool -> transaction ID -> send ID
+	outstanding map[string]transfer
+}
+
+func NewClaims() *Claims {
+	return &Claims{
+		claimed:     map[Address]map[string]string{},
+		outstanding: map[string]transfer{},
+	}
+}
+
+// Sent marks t as made, so only it can claim a transaction that has to be its own
+func (c *Claims) Sent(t transfer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.outstanding[t.id] = t
+}
+
+// Confirmed records that txnID is t's, for a send confirmed before c knew about it
+func (c *Claims) Confirmed(t transfer, txnID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.claim(t, txnID)
+}
+
+// Claim returns the transaction in txns that confirms t and claims it, or nil if
+// there's none. An outstanding t takes the earliest transaction that fits. Any other
+// t only takes one that's left once every outstanding send has had its pick
+func (c *Claims) Claim(t transfer, txns []*Transaction) *Transaction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var candidates []*Transaction
+	for _, txn := range txns {
+		if _, ok := c.claimed[t.from][txn.ID()]; !ok && t.matches(txn) {
+			candidates = append(candidates, txn)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Timestamp.Before(candidates[j].Timestamp) })
+
+	if _, ok := c.outstanding[t.id]; !ok {
+		candidates = c.unreserved(t, candidates)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	txn := candidates[0]
+	c.claim(t, txn.ID())
+	return txn
+}
+
+// unreserved leaves out of candidates, sorted oldest first, a transaction for every
+// outstanding send that looks like t. The sends that can only be confirmed by the
+// most recent transactions go first, so each of them gets one if there's any way to
+func (c *Claims) unreserved(t transfer, candidates []*Transaction) []*Transaction {
+	var sends []transfer
+	for _, send := range c.outstanding {
+		if send.from == t.from && send.to == t.to && send.amount == t.amount {
+			sends = append(sends, send)
+		}
+	}
+	sort.Slice(sends, func(i, j int) bool { return sends[i].after.After(sends[j].after) })
+
+	left := append([]*Transaction{}, candidates...)
+	for _, send := range sends {
+		for i, txn := range left {
+			if send.matches(txn) {
+				left = append(left[:i], left[i+1:]...)
+				break
+			}
+		}
+	}
+	return left
+}
+
+func (c *Claims) claim(t transfer, txnID string) {
+	if c.claimed[t.from] == nil {
+		c.claimed[t.from] = map[string]string{}
+	}
+	c.claimed[t.from][txnID] = t.id
+	delete(c.outstanding, t.id)
+}
+
+// Add records what c needs to know about intents made before c was shared with them:
+// the transactions that confirmed them and the ones that are outstanding
+func (c *Claims) Add(intents ...*PayoutIntent) {
+	for _, intent := range intents {
+		switch intent.Status {
+		case PAYOUT_SENT:
+			c.Sent(intent.transfer())
+		case PAYOUT_CONFIRMED:
+			c.Confirmed(intent.transfer(), intent.Transaction)
+		}
+	}
+}
+
+// useClaims makes b share claims, telling it about the sends b made before
+func (b *Batch) useClaims(claims *Claims) {
+	claims.Add(b.Outbox.Intents...)
+	for _, f := range b.Forwards {
+		if f.Forwarded {
+			claims.Sent(f.transfer(b.Source.Address))
+		}
+	}
+	b.Claims = claims
+}
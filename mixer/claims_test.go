@@ -0,0 +1,61 @@
+package mixer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// a batch whose process died after its first payout, with intents still to send
+func interruptedBatch(ledger *testLedger, source Address, claims *Claims, statuses ...PayoutStatus) *Batch {
+	batch := NewBatch(Coin(1000), Coin(0), NewWallet(ledger, source), []Address{"Bob"}, 1)
+	batch.PollInterval = 0
+	batch.Claims = claims
+	for i, status := range statuses {
+		intent := NewPayoutIntent(source, i, "Pool", "Bob", Coin(100), time.Now())
+		if status == PAYOUT_SENT {
+			ledger.SendTransaction(context.Background(), "Pool", "Bob", Coin(100))
+		}
+		intent.Status = status
+		intent.unsure = true
+		batch.Outbox.Intents = append(batch.Outbox.Intents, intent)
+	}
+	claims.Add(batch.Outbox.Intents...)
+	return batch
+}
+
+func TestBatchExecuteIdenticalIntents(t *testing.T) {
+	fmt.Println("Running TestBatchExecuteIdenticalIntents...")
+
+	// a planned intent mustn't be confirmed by the transaction of a sent one like it
+	ledger := &testLedger{}
+	batch := interruptedBatch(ledger, "Tumbler", NewClaims(), PAYOUT_SENT, PAYOUT_PLANNED)
+	err := batch.Execute(context.Background(), NewWallet(ledger, "Pool"))
+	if err != nil {
+		t.Fatalf("Batch.Execute returned unexpected error %s", err)
+	}
+
+	if len(ledger.txns) != 2 {
+		t.Errorf("Expected the planned payout to be sent, saw %v", ledger.txns)
+	}
+	first, second := batch.Outbox.Intents[0], batch.Outbox.Intents[1]
+	if first.Status != PAYOUT_CONFIRMED || second.Status != PAYOUT_CONFIRMED || first.Transaction == second.Transaction {
+		t.Errorf("Expected each payout to be confirmed by a transaction of its own, saw %v and %v", first, second)
+	}
+
+	// nor by one sent by another batch paying out of the same pool
+	ledger = &testLedger{}
+	claims := NewClaims()
+	sent := interruptedBatch(ledger, "Tumbler-1", claims, PAYOUT_SENT)
+	planned := interruptedBatch(ledger, "Tumbler-2", claims, PAYOUT_PLANNED)
+	for _, batch := range []*Batch{planned, sent} {
+		err = batch.Execute(context.Background(), NewWallet(ledger, "Pool"))
+		if err != nil {
+			t.Fatalf("Batch.Execute returned unexpected error %s for '%s'", err, batch.Source.Address)
+		}
+	}
+	if len(ledger.txns) != 2 || sent.Outbox.Intents[0].Transaction == planned.Outbox.Intents[0].Transaction {
+		t.Errorf("Expected both batches to be confirmed by a transaction of their own, saw %v", ledger.txns)
+	}
+}
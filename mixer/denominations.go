@@ -0,0 +1,165 @@
+package mixer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	REMAINDER_FEE    = "fee"    // what doesn't make up a denomination stays in the pool
+	REMAINDER_CHANGE = "change" // or is paid to the recipient as a payout of its own
+
+	DEFAULT_REMAINDER = REMAINDER_FEE
+
+	// the most transactions a single share can be broken into
+	MAX_DENOMINATION_PAYOUTS = 100
+)
+
+// Denominations makes a batch pay out in a fixed set of standard amounts instead of
+// arbitrary ones, so payouts can't be matched back to a deposit by adding them up.
+// Every share is broken into as few of Values as possible, each sent as a transaction
+// of its own, and Remainder says what happens to the part smaller than all of them
+type Denominations struct {
+	Values    []Coin `json:"values"` // largest first
+	Remainder string `json:"remainder"`
+}
+
+func NewDenominations(values []Coin, remainder string) (*Denominations, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("At least one denomination is needed")
+	}
+	if remainder != REMAINDER_FEE && remainder != REMAINDER_CHANGE {
+		return nil, fmt.Errorf("Unknown remainder handling '%s', expected '%s' or '%s'", remainder, REMAINDER_FEE, REMAINDER_CHANGE)
+	}
+
+	seen := map[Coin]bool{}
+	var sorted []Coin
+	for _, value := range values {
+		if value <= 0 {
+			return nil, fmt.Errorf("Denominations have to be positive")
+		}
+		if !seen[value] {
+			seen[value] = true
+			sorted = append(sorted, value)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+
+	return &Denominations{sorted, remainder}, nil
+}
+
+// ParseDenominations reads a comma separated list of amounts such as "0.01,0.1,1,10"
+// at the given precision
+func ParseDenominations(s string, precision int, remainder string) (*Denominations, error) {
+	var values []Coin
+	for _, field := range strings.Split(s, ",") {
+		value, err := ParseCoin(strings.TrimSpace(field), precision)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid denomination '%s': %s", field, err)
+		}
+		if value <= 0 {
+			return nil, fmt.Errorf("Denomination '%s' has to be positive", field)
+		}
+		values = append(values, value)
+	}
+	return NewDenominations(values, remainder)
+}
+
+// Split breaks amount into denominations, largest first, and returns them along
+// with the remainder that's smaller than every denomination
+func (d *Denominations) Split(amount Coin) ([]Coin, Coin, error) {
+	var payouts []Coin
+	for _, value := range d.Values {
+		count := amount / value
+		if int64(len(payouts))+int64(count) > MAX_DENOMINATION_PAYOUTS {
+			return nil, amount, fmt.Errorf("Paying it in denominations takes more than %d transactions", MAX_DENOMINATION_PAYOUTS)
+		}
+		for ; count > 0; count-- {
+			payouts = append(payouts, value)
+		}
+		amount %= value
+	}
+	return payouts, amount, nil
+}
+
+// MaxPayouts is the most payouts Split makes of any amount up to amount, so a batch
+// can be held to MAX_DENOMINATION_PAYOUTS before its shares are known
+func (d *Denominations) MaxPayouts(amount Coin) int64 {
+	below := map[int]int64{}
+	var most func(amount Coin, i int) int64
+	most = func(amount Coin, i int) int64 {
+		if i == len(d.Values) || amount <= 0 {
+			return 0
+		}
+		value := d.Values[i]
+		count := int64(amount / value)
+		n := count + most(amount%value, i+1)
+
+		// one value fewer leaves room for the largest amount the smaller ones can make
+		if count > 0 && amount%value != value-1 {
+			if _, ok := below[i]; !ok {
+				below[i] = most(value-1, i+1)
+			}
+			if count-1+below[i] > n {
+				n = count - 1 + below[i]
+			}
+		}
+		return n
+	}
+	return most(amount, 0)
+}
+
+// checkDenominations makes sure amount, what b pays out after its fee, can be paid in
+// b.Denominations. Fixed amounts, and whatever share of the rest a recipient could be
+// given, have to fit in MAX_DENOMINATION_PAYOUTS. With REMAINDER_FEE the rest has to
+// make up at least the smallest denomination for each recipient sharing it, or it
+// would be kept back as remainder instead of being paid out
+func (b *Batch) checkDenominations(amount Coin) error {
+	d := b.Denominations
+	rest := amount
+	shared := 0
+	for _, destination := range b.Destinations {
+		if destination.Amount == 0 {
+			shared += 1
+			continue
+		}
+		_, _, err := d.Split(destination.Amount)
+		if err != nil {
+			return fmt.Errorf("Can't pay %v to '%s': %s", b.format(destination.Amount), destination.Address, err)
+		}
+		rest -= destination.Amount
+	}
+	if shared == 0 || rest <= 0 {
+		return nil
+	}
+
+	if n := d.MaxPayouts(rest); n > MAX_DENOMINATION_PAYOUTS {
+		return fmt.Errorf("Paying up to %v to a recipient in denominations of %v can take %d transactions, more than %d",
+			b.format(rest), d.Format(PrecisionOf(b.Source.ledger)), n, MAX_DENOMINATION_PAYOUTS)
+	}
+
+	if d.Remainder != REMAINDER_FEE {
+		return nil
+	}
+	smallest := d.Values[len(d.Values)-1]
+	least, err := smallest.MulRatio(int64(shared), 1)
+	if err != nil || rest < least {
+		return fmt.Errorf("%v can't pay each of %d recipients the smallest denomination of %v, the rest would be kept as fee",
+			b.format(rest), shared, b.format(smallest))
+	}
+	return nil
+}
+
+func (d *Denominations) String() string {
+	return d.Format(DEFAULT_PRECISION)
+}
+
+// Format lists d's values with precision decimal places, as ParseDenominations reads them
+func (d *Denominations) Format(precision int) string {
+	var values []string
+	for _, value := range d.Values {
+		values = append(values, value.Format(precision))
+	}
+	return strings.Join(values, ",")
+}
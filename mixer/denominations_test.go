@@ -0,0 +1,168 @@
+package mixer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseDenominations(t *testing.T) {
+	fmt.Println("Running TestParseDenominations...")
+
+	denominations, err := ParseDenominations("1, 0.01,10,0.1,1", 2, REMAINDER_FEE)
+	if err != nil {
+		t.Fatalf("ParseDenominations returned unexpected error %s", err)
+	}
+	if denominations.String() != "10.00,1.00,0.10,0.01" {
+		t.Errorf("Expected denominations to be deduplicated and sorted largest first, saw %s", denominations)
+	}
+
+	invalid := []struct {
+		s         string
+		remainder string
+	}{
+		{"0.01,0", REMAINDER_FEE},
+		{"0.01,-1", REMAINDER_FEE},
+		{"0.01,,1", REMAINDER_FEE},
+		{"0.001", REMAINDER_FEE},
+		{"0.01,1", "burn"},
+	}
+	for _, c := range invalid {
+		_, err = ParseDenominations(c.s, 2, c.remainder)
+		if err == nil {
+			t.Errorf("Expected ParseDenominations(%s, %s) to fail", c.s, c.remainder)
+		}
+	}
+}
+
+func TestDenominationsSplit(t *testing.T) {
+	fmt.Println("Running TestDenominationsSplit...")
+
+	denominations, _ := NewDenominations([]Coin{Coin(10), Coin(100)}, REMAINDER_FEE)
+	payouts, remainder, err := denominations.Split(Coin(327))
+	if err != nil {
+		t.Fatalf("Denominations.Split returned unexpected error %s", err)
+	}
+	expected := []Coin{100, 100, 100, 10, 10}
+	if fmt.Sprint(payouts) != fmt.Sprint(expected) || remainder != Coin(7) {
+		t.Errorf("Expected 3.27 to split into %v with 0.07 left over, saw %v and %v", expected, payouts, remainder)
+	}
+
+	_, _, err = denominations.Split(Coin(100 * (MAX_DENOMINATION_PAYOUTS + 1)))
+	if err == nil {
+		t.Errorf("Expected Denominations.Split to refuse to make more than %d payouts", MAX_DENOMINATION_PAYOUTS)
+	}
+
+	// MaxPayouts agrees with splitting every amount up to the limit
+	denominations, _ = NewDenominations([]Coin{Coin(3), Coin(25), Coin(40)}, REMAINDER_FEE)
+	most := 0
+	for amount := Coin(0); amount <= Coin(500); amount++ {
+		payouts, _, _ := denominations.Split(amount)
+		if len(payouts) > most {
+			most = len(payouts)
+		}
+		if denominations.MaxPayouts(amount) != int64(most) {
+			t.Fatalf("Expected at most %d payouts up to %v, MaxPayouts said %d", most, amount, denominations.MaxPayouts(amount))
+		}
+	}
+}
+
+func TestMixerNewBatchDenominations(t *testing.T) {
+	fmt.Println("Running TestMixerNewBatchDenominations...")
+
+	ledger := &testLedger{}
+	tens, _ := NewDenominations([]Coin{Coin(1000)}, REMAINDER_FEE)
+	cents, _ := NewDenominations([]Coin{Coin(1)}, REMAINDER_FEE)
+	change, _ := NewDenominations([]Coin{Coin(1000)}, REMAINDER_CHANGE)
+
+	cases := []struct {
+		denominations *Denominations
+		amount        Coin
+		valid         bool
+	}{
+		{tens, Coin(5000), true},
+		{tens, Coin(900), false},   // 8.82 after the fee is less than a single 10.00
+		{tens, Coin(1500), false},  // 14.70 can't give both recipients 10.00
+		{change, Coin(900), true},  // paid out as change instead
+		{cents, Coin(1000), false}, // up to 980 payouts of 0.01
+	}
+
+	for i, c := range cases {
+		mixer := NewMixer(ledger, nil)
+		mixer.Denominations = c.denominations
+		source := NewWallet(ledger, Address(fmt.Sprintf("Tumbler-%d", i)))
+		_, err := mixer.NewBatch(source, NewAmount(c.amount, DEFAULT_ASSET, DEFAULT_PRECISION), NewDestinations([]Address{"Bob", "Charles"}), 1, UniformStrategy{})
+		if c.valid && err != nil {
+			t.Errorf("Expected %v in denominations of %v to be accepted, saw '%s'", c.amount.ToString(), c.denominations, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("Expected %v in denominations of %v to be rejected", c.amount.ToString(), c.denominations)
+		}
+	}
+}
+
+func TestMixerRunDenominations(t *testing.T) {
+	fmt.Println("Running TestMixerRunDenominations...")
+
+	for _, remainder := range []string{REMAINDER_FEE, REMAINDER_CHANGE} {
+		sim := NewSimulator()
+		ledger, server := newSimulatedLedger(sim)
+
+		denominations, _ := NewDenominations([]Coin{Coin(25), Coin(100)}, remainder)
+		mixer := NewMixer(ledger, nil)
+		mixer.Denominations = denominations
+		mixer.Pool = func(ledger Ledger) *Wallet {
+			return NewWallet(ledger, "Pool")
+		}
+		mixer.Watcher.PollInterval = time.Duration(10) * time.Millisecond
+
+		amount := Coin(1234)
+		recipients := NewAddresses(3)
+		source := NewWallet(ledger, NewAddresses(1)[0])
+		batch, err := mixer.NewBatch(source, NewAmount(amount, DEFAULT_ASSET, DEFAULT_PRECISION), NewDestinations(recipients), 5, UniformStrategy{})
+		if err != nil {
+			t.Fatalf("Mixer.NewBatch returned unexpected error %s", err)
+		}
+		batch.PollInterval = time.Duration(10) * time.Millisecond
+		batch.DelayGenerator = func(maxDelay int) int {
+			return 0
+		}
+		sim.Mint("Alice", amount)
+		sim.Send("Alice", source.Address, amount)
+		mixer.Run()
+		server.Close()
+
+		plan, err := batch.Plan(NewWallet(ledger, "Pool"))
+		if err != nil {
+			t.Fatalf("Batch.Plan returned unexpected error %s", err)
+		}
+
+		changes := map[Address]int{}
+		paidOut := Coin(0)
+		for _, payout := range plan.Payouts {
+			if payout.Status != PAYOUT_CONFIRMED {
+				t.Errorf("Expected payout %v to be confirmed", payout)
+			}
+			if payout.Amount != Coin(25) && payout.Amount != Coin(100) {
+				changes[payout.Recipient] += 1
+				if remainder == REMAINDER_FEE || payout.Amount >= Coin(25) {
+					t.Errorf("Unexpected payout of %v with remainder handled as %s", payout.Amount.ToString(), remainder)
+				}
+			}
+			paidOut += payout.Amount
+		}
+		for recipient, count := range changes {
+			if count > 1 {
+				t.Errorf("Expected at most one change payout to '%s', saw %d", recipient, count)
+			}
+		}
+
+		if remainder == REMAINDER_CHANGE && plan.Remainder != 0 {
+			t.Errorf("Expected the remainder to be paid out as change, saw %v kept", plan.Remainder.ToString())
+		}
+		if paidOut+plan.Remainder != amount-batch.Fee || sim.Balance("Pool") != batch.Fee+plan.Remainder {
+			t.Errorf("Expected %v paid out and %v pooled, saw %v paid out with %v remainder and %v pooled",
+				(amount - batch.Fee).ToString(), batch.Fee.ToString(), paidOut.ToString(), plan.Remainder.ToString(), sim.Balance("Pool").ToString())
+		}
+	}
+}
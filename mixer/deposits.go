@@ -0,0 +1,195 @@
+package mixer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// deposits stamped by the ledger up to this long before a batch started, or before
+// the newest deposit seen so far, are still picked up. It absorbs clock skew between
+// Apollo and the ledger, and transactions the ledger makes visible out of order
+const CLOCK_SKEW_ALLOWANCE = time.Duration(1) * time.Minute
+
+// DepositTracker decides which transactions to a tumbler address are new deposits.
+// The local clock is only used once, for the starting point. After that the polling
+// cutoff follows the watermark, the newest ledger timestamp seen, and the overlap
+// that CLOCK_SKEW_ALLOWANCE leaves is resolved by transaction ID, so every deposit is
+// credited exactly once however slow the ledger is to respond
+type DepositTracker struct {
+	mutex     sync.Mutex
+	Address   Address
+	Asset     Asset
+	start     time.Time
+	watermark time.Time
+	seen      map[string]bool
+}
+
+func NewDepositTracker(address Address, asset Asset, start time.Time) *DepositTracker {
+	return &DepositTracker{
+		Address:   address,
+		Asset:     asset,
+		start:     start.Add(-CLOCK_SKEW_ALLOWANCE),
+		watermark: start,
+		seen:      map[string]bool{},
+	}
+}
+
+// Cutoff is the time to fetch transactions after. Anything older has either been
+// seen already or was sent before the batch started
+func (d *DepositTracker) Cutoff() time.Time {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	cutoff := d.watermark.Add(-CLOCK_SKEW_ALLOWANCE)
+	if cutoff.Before(d.start) {
+		return d.start
+	}
+	return cutoff
+}
+
+// MarkSeen makes Track ignore the transactions with the given IDs, for a batch that's
+// resuming after it already credited them
+func (d *DepositTracker) MarkSeen(ids ...string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, id := range ids {
+		d.seen[id] = true
+	}
+}
+
+// Track returns the transactions in txns that are deposits to d.Address it hasn't
+// returned before, and moves the watermark past them. Deposits of any asset other
+// than d.Asset are rejected, they can't be credited to the batch. So are deposits with
+// no source, like coins minted straight to d.Address: an expired batch refunds its
+// deposits, and there would be nowhere to send them
+func (d *DepositTracker) Track(txns []*Transaction) []*Transaction {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var deposits []*Transaction
+	for _, txn := range txns {
+		if txn.Recipient != d.Address || !txn.Timestamp.After(d.start) {
+			continue
+		}
+
+		id := txn.ID()
+		if d.seen[id] {
+			continue
+		}
+		d.seen[id] = true
+		if txn.Asset != d.Asset {
+			fmt.Printf("Rejecting deposit %v: %s, expected %s\n", txn, ErrAssetMismatch, d.Asset)
+			continue
+		}
+		if txn.Source == "" {
+			fmt.Printf("Rejecting deposit %v: it has no source to refund it to\n", txn)
+			continue
+		}
+		deposits = append(deposits, txn)
+
+		if txn.Timestamp.After(d.watermark) {
+			d.watermark = txn.Timestamp
+		}
+	}
+	return deposits
+}
+
+// Forward is a deposit on its way from the tumbler address to the pool. It's journaled
+// before it's sent, so a batch that resumes knows every forward it may have made and
+// looks for it in the pool's history instead of sending it again
+type Forward struct {
+	Deposit   string  // ID of the deposit transaction
+	Depositor Address // where the deposit came from, which is refunded if the batch expires
+	Pool      Address
+	Amount    Coin
+	StartedAt time.Time
+	Forwarded bool
+
+	unsure bool // see Batch.send
+}
+
+// transfer is the transaction on the ledger that moves f's deposit out of source
+func (f *Forward) transfer(source Address) transfer {
+	return transfer{"forward:" + f.Deposit, source, f.Pool, f.Amount, f.StartedAt.Add(-CLOCK_SKEW_ALLOWANCE)}
+}
+
+// startForwards journals a Forward of each of deposits, before any is sent. They all go
+// to the pool the first one went to, even once pool has moved on to another address
+func (b *Batch) startForwards(pool *Wallet, deposits []*Transaction) ([]*Forward, error) {
+	if b.Pool == "" {
+		b.Pool = pool.Address
+	}
+
+	var forwards []*Forward
+	for _, txn := range deposits {
+		f := &Forward{Deposit: txn.ID(), Depositor: txn.Source, Pool: b.Pool, Amount: txn.Amount, StartedAt: time.Now().UTC()}
+		err := b.record(JOURNAL_FORWARD, JournalEntry{
+			Time: f.StartedAt, Transaction: f.Deposit, Depositor: f.Depositor, Pool: f.Pool, Amount: f.Amount})
+		if err != nil {
+			return forwards, err
+		}
+		b.Forwards = append(b.Forwards, f)
+		forwards = append(forwards, f)
+	}
+	return forwards, nil
+}
+
+// pendingForwards returns the forwards that haven't been credited yet
+func (b *Batch) pendingForwards() []*Forward {
+	var pending []*Forward
+	for _, f := range b.Forwards {
+		if !f.Forwarded {
+			pending = append(pending, f)
+		}
+	}
+	return pending
+}
+
+// forward moves f's deposit to the pool. An unsure forward is looked for in the pool's
+// history before it's sent. So is one the ledger refuses for lack of funds: the deposit
+// was seen on the ledger, so the tumbler address can only be short of it if it was
+// forwarded already
+func (b *Batch) forward(ctx context.Context, pool *Wallet, f *Forward) error {
+	found, err := b.send(ctx, b.Source, f.Pool, f.Amount, &f.unsure, func(ctx context.Context) (bool, error) {
+		return b.forwarded(ctx, pool, f)
+	})
+	if found {
+		return nil
+	}
+	if errors.Is(err, ErrInsufficientFunds) {
+		found, findErr := b.forwarded(ctx, pool, f)
+		if findErr != nil || found {
+			return findErr
+		}
+		return fmt.Errorf("Deposit %s of %v is neither in '%s' nor in the pool: %w", f.Deposit, b.format(f.Amount), b.Source.Address, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	b.Claims.Sent(f.transfer(b.Source.Address))
+	return b.markForwarded(f)
+}
+
+// forwarded looks for f in its pool's history, and credits it if it's there
+func (b *Batch) forwarded(ctx context.Context, pool *Wallet, f *Forward) (bool, error) {
+	info, err := pool.ledger.GetAddressInfo(ctx, f.Pool)
+	if err != nil {
+		return false, err
+	}
+	if b.Claims.Claim(f.transfer(b.Source.Address), info.Transactions) == nil {
+		return false, nil
+	}
+
+	fmt.Printf("Deposit %s was already forwarded to '%s', not forwarding it again\n", f.Deposit, f.Pool)
+	return true, b.markForwarded(f)
+}
+
+func (b *Batch) markForwarded(f *Forward) error {
+	f.Forwarded = true
+	return b.record(JOURNAL_DEPOSIT, JournalEntry{Transaction: f.Deposit, Pool: f.Pool, Amount: f.Amount})
+}
@@ -0,0 +1,220 @@
+package mixer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDepositTrackerTrack(t *testing.T) {
+	fmt.Println("Running TestDepositTrackerTrack...")
+
+	start := time.Now()
+	tracker := NewDepositTracker("Tumbler", DEFAULT_ASSET, start)
+
+	// the ledger's clock is 30 seconds behind ours
+	skewed := &Transaction{start.Add(time.Duration(-30) * time.Second), "Alice", "Tumbler", Coin(100), DEFAULT_ASSET, 0}
+	before := &Transaction{start.Add(time.Duration(-2) * time.Minute), "Alice", "Tumbler", Coin(200), DEFAULT_ASSET, 0}
+	other := &Transaction{start.Add(time.Second), "Alice", "Bob", Coin(300), DEFAULT_ASSET, 0}
+
+	minted := &Transaction{start.Add(time.Second), "", "Tumbler", Coin(400), DEFAULT_ASSET, 0}
+
+	deposits := tracker.Track([]*Transaction{skewed, before, other, minted})
+	if len(deposits) != 1 || deposits[0] != skewed {
+		t.Errorf("Expected only the skewed deposit to be tracked, saw %v", deposits)
+	}
+
+	deposits = tracker.Track([]*Transaction{skewed})
+	if len(deposits) != 0 {
+		t.Errorf("Expected a deposit seen twice to be tracked once, saw %v", deposits)
+	}
+
+	late := &Transaction{start.Add(time.Duration(10) * time.Minute), "Alice", "Tumbler", Coin(100), DEFAULT_ASSET, 0}
+	tracker.Track([]*Transaction{late})
+	if expected := late.Timestamp.Add(-CLOCK_SKEW_ALLOWANCE); !tracker.Cutoff().Equal(expected) {
+		t.Errorf("Expected the cutoff to follow the newest deposit to %v, saw %v", expected, tracker.Cutoff())
+	}
+}
+
+// a deposit the ledger stamped while the previous poll was in flight is still credited
+func TestBatchPollTransactionsSlowResponse(t *testing.T) {
+	fmt.Println("Running TestBatchPollTransactionsSlowResponse...")
+
+	ledger := &testLedger{}
+	source := NewWallet(ledger, "Tumbler")
+	batch := NewBatch(Coin(100), Coin(0), source, []Address{"Bob"}, 5)
+	batch.PollInterval = time.Duration(10) * time.Millisecond
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+
+	deposit := &Transaction{time.Now(), "Alice", "Tumbler", Coin(100), DEFAULT_ASSET, 0}
+	polls := 0
+	batch.Fetch = func(ctx context.Context, w *Wallet, cutoff time.Time) ([]*Transaction, error) {
+		polls += 1
+		if polls == 1 {
+			// the deposit lands after the ledger built this response
+			time.Sleep(time.Duration(20) * time.Millisecond)
+			return nil, nil
+		}
+		if !deposit.Timestamp.After(cutoff) {
+			return nil, nil
+		}
+		return []*Transaction{deposit, deposit}, nil
+	}
+
+	err := batch.PollTransactions(NewWallet(ledger, "Pool"))
+	if err != nil {
+		t.Fatalf("Batch.PollTransactions returned unexpected error %s", err)
+	}
+
+	if polls < 2 {
+		t.Fatalf("Expected the batch to poll until it saw the deposit, saw %d polls", polls)
+	}
+	// one forward to the pool and one payout to Bob
+	if len(ledger.txns) != 2 || ledger.txns[0].Amount != Coin(100) {
+		t.Errorf("Expected the deposit to be credited once, saw %v", ledger.txns)
+	}
+}
+
+// a forward journaled before the process died is looked for in the pool when the
+// batch resumes: made, it's credited without sending it again, otherwise it's sent
+func TestBatchResumeForwards(t *testing.T) {
+	fmt.Println("Running TestBatchResumeForwards...")
+
+	for _, made := range []bool{true, false} {
+		path, cleanup := tempJournal(t)
+		defer cleanup()
+		journal, _ := OpenJournal(path)
+		defer journal.Close()
+
+		sim := NewSimulator()
+		ledger, server := newSimulatedLedger(sim)
+		defer server.Close()
+		pool := NewWallet(ledger, "Pool")
+
+		amount := Coin(1000)
+		mixer := NewMixer(ledger, nil)
+		mixer.Journal = journal
+		source := NewWallet(ledger, NewAddresses(1)[0])
+		batch, _ := mixer.NewBatch(source, NewAmount(amount, DEFAULT_ASSET, DEFAULT_PRECISION), NewDestinations(NewAddresses(2)), 5, HalvingStrategy{})
+		sim.Mint("Alice", amount)
+		sim.Send("Alice", source.Address, amount)
+
+		deposits, _ := source.GetAddressTransactions(batch.StartTime.Add(-CLOCK_SKEW_ALLOWANCE))
+		_, err := batch.startForwards(pool, batch.Deposits.Track(deposits))
+		if err != nil {
+			t.Fatalf("Batch.startForwards returned unexpected error %s", err)
+		}
+		if made {
+			sim.Send(source.Address, pool.Address, amount)
+		}
+
+		unfinished, _ := journal.Unfinished()
+		resumed, err := unfinished[0].Restore(ledger, journal)
+		if err != nil || len(resumed.pendingForwards()) != 1 {
+			t.Fatalf("Expected the batch to resume with its forward pending, saw %v and error %v", resumed, err)
+		}
+		resumed.PollInterval = time.Duration(10) * time.Millisecond
+		resumed.DelayGenerator = func(maxDelay int) int {
+			return 0
+		}
+
+		// the pool has moved on to another address since
+		err = resumed.PollTransactions(NewWallet(ledger, "Pool-2"))
+		if err != nil {
+			t.Fatalf("Batch.PollTransactions returned unexpected error %s after resuming", err)
+		}
+		forwards := 0
+		for _, txn := range sim.Transactions() {
+			if txn.Source == source.Address {
+				forwards += 1
+			}
+		}
+		if forwards != 1 || resumed.Credited != amount || sim.Balance(pool.Address) != batch.Fee || sim.Balance("Pool-2") != 0 {
+			t.Errorf("Expected the deposit to be forwarded once and paid out of its pool, saw %d forwards, %v credited and %v pooled",
+				forwards, resumed.Credited.ToString(), sim.Balance(pool.Address).ToString())
+		}
+	}
+}
+
+// a batch that times out short of its amount is journaled as expired and refunds what
+// it was sent to the address it came from
+func TestBatchExpire(t *testing.T) {
+	fmt.Println("Running TestBatchExpire...")
+
+	path, cleanup := tempJournal(t)
+	defer cleanup()
+	journal, _ := OpenJournal(path)
+	defer journal.Close()
+
+	sim := NewSimulator()
+	ledger, server := newSimulatedLedger(sim)
+	defer server.Close()
+	pool := NewWallet(ledger, "Pool")
+
+	mixer := NewMixer(ledger, nil)
+	mixer.Journal = journal
+	source := NewWallet(ledger, NewAddresses(1)[0])
+	batch, _ := mixer.NewBatch(source, NewAmount(Coin(1000), DEFAULT_ASSET, DEFAULT_PRECISION), NewDestinations(NewAddresses(2)), 5, HalvingStrategy{})
+	batch.PollInterval = time.Duration(10) * time.Millisecond
+	batch.Timeout = time.Duration(100) * time.Millisecond
+
+	sim.Mint("Alice", Coin(400))
+	sim.Send("Alice", source.Address, Coin(400))
+
+	err := batch.PollTransactions(pool)
+	if err != nil {
+		t.Fatalf("Batch.PollTransactions returned unexpected error %s", err)
+	}
+	if !batch.Expired || batch.Credited != Coin(400) {
+		t.Errorf("Expected the batch to expire with 4.00 credited, saw %v credited", batch.Credited.ToString())
+	}
+	if sim.Balance("Alice") != Coin(400) || sim.Balance(pool.Address) != 0 {
+		t.Errorf("Expected the deposit to be refunded in full, saw %v with Alice and %v pooled",
+			sim.Balance("Alice").ToString(), sim.Balance(pool.Address).ToString())
+	}
+
+	unfinished, _ := journal.Unfinished()
+	if len(unfinished) != 0 {
+		t.Errorf("Expected the expired batch not to be resumed, saw %v", unfinished)
+	}
+}
+
+// throttledLedger rate limits its next sends
+type throttledLedger struct {
+	*testLedger
+	throttled int
+}
+
+func (l *throttledLedger) SendTransaction(ctx context.Context, source, recipient Address, amount Coin) error {
+	if l.throttled > 0 {
+		l.throttled -= 1
+		return &LedgerError{"POST", "/api/transactions", http.StatusTooManyRequests, "", ErrRateLimited}
+	}
+	return l.testLedger.SendTransaction(ctx, source, recipient, amount)
+}
+
+// an expired batch waits for a forward the ledger is throttling before it refunds it
+func TestBatchExpireThrottledForward(t *testing.T) {
+	fmt.Println("Running TestBatchExpireThrottledForward...")
+
+	// every attempt of the first poll's forward is throttled
+	ledger := &throttledLedger{&testLedger{}, MAX_SEND_ATTEMPTS}
+	pool := NewWallet(ledger, "Pool")
+	batch := NewBatch(Coin(1000), Coin(0), NewWallet(ledger, "Tumbler"), []Address{"Bob"}, 1)
+	batch.PollInterval = 0
+
+	deposit := &Transaction{time.Now(), "Alice", "Tumbler", Coin(400), DEFAULT_ASSET, 0}
+	batch.startForwards(pool, []*Transaction{deposit})
+	err := batch.expire(context.Background(), pool)
+	if err != nil {
+		t.Fatalf("Batch.expire returned unexpected error %s", err)
+	}
+
+	if len(ledger.txns) != 2 || ledger.txns[1].Recipient != "Alice" || ledger.txns[1].Amount != Coin(400) {
+		t.Errorf("Expected the deposit to be forwarded and then refunded to Alice, saw %v", ledger.txns)
+	}
+}
@@ -0,0 +1,202 @@
+package mixer
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Destination is a recipient of a batch and how its payout is worked out. A fixed
+// Amount is paid exactly, a Weight gets that share of what's left after the fixed
+// amounts and the fee. A Destination with neither leaves its share to the batch's
+// PayoutStrategy, or counts as a weight of 1 when other destinations have weights
+type Destination struct {
+	Address Address `json:"address"`
+	Weight  int64   `json:"weight,omitempty"`
+	Amount  Coin    `json:"amount,omitempty"`
+}
+
+// ParseDestination reads "address", "address:weight" or "address=amount", with the
+// amount at the given precision
+func ParseDestination(s string, precision int) (Destination, error) {
+	if i := strings.Index(s, "="); i >= 0 {
+		amount, err := ParseCoin(s[i+1:], precision)
+		if err != nil {
+			return Destination{}, fmt.Errorf("Invalid amount in destination '%s': %s", s, err)
+		}
+		if amount <= 0 {
+			return Destination{}, fmt.Errorf("Amount in destination '%s' has to be positive", s)
+		}
+		return newDestination(s, s[:i], 0, amount)
+	}
+
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		weight, err := strconv.ParseInt(s[i+1:], 10, 64)
+		if err != nil || weight <= 0 {
+			return Destination{}, fmt.Errorf("Weight in destination '%s' has to be a positive integer", s)
+		}
+		return newDestination(s, s[:i], weight, 0)
+	}
+
+	return newDestination(s, s, 0, 0)
+}
+
+func newDestination(s, address string, weight int64, amount Coin) (Destination, error) {
+	if address == "" {
+		return Destination{}, fmt.Errorf("Destination '%s' has no address", s)
+	}
+	return Destination{Address(address), weight, amount}, nil
+}
+
+// NewDestinations makes a Destination of each address, leaving the split to the
+// batch's PayoutStrategy
+func NewDestinations(addresses []Address) []Destination {
+	destinations := make([]Destination, len(addresses))
+	for i, address := range addresses {
+		destinations[i] = Destination{Address: address}
+	}
+	return destinations
+}
+
+func destinationAddresses(destinations []Destination) []Address {
+	addresses := make([]Address, len(destinations))
+	for i, destination := range destinations {
+		addresses[i] = destination.Address
+	}
+	return addresses
+}
+
+// checkDestinations makes sure every address is only listed once, and that what's
+// paid out of amount after fee covers the fixed amounts. If every destination is
+// fixed they have to add up to it exactly, there'd be nobody to pay the rest to.
+// Amounts in errors are written at precision
+func checkDestinations(destinations []Destination, amount, fee Coin, precision int) error {
+	seen := map[Address]bool{}
+	fixed := Coin(0)
+	allFixed := true
+	for _, destination := range destinations {
+		if seen[destination.Address] {
+			return fmt.Errorf("Destination '%s' is listed more than once", destination.Address)
+		}
+		seen[destination.Address] = true
+
+		if destination.Amount == 0 {
+			allFixed = false
+			continue
+		}
+		var err error
+		fixed, err = fixed.Add(destination.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	left, err := amount.Sub(fee)
+	if err == nil {
+		left, err = left.Sub(fixed)
+	}
+	if err != nil {
+		return err
+	}
+	if left < 0 {
+		return fmt.Errorf("Fixed amounts of %v and fee of %v don't fit in %v",
+			fixed.Format(precision), fee.Format(precision), amount.Format(precision))
+	}
+	if allFixed && len(destinations) > 0 && left != 0 {
+		return fmt.Errorf("Fixed amounts of %v and fee of %v leave %v of %v unassigned, add a destination without a fixed amount",
+			fixed.Format(precision), fee.Format(precision), left.Format(precision), amount.Format(precision))
+	}
+	return nil
+}
+
+// shares returns the part of amount each of recipients is paid, in order. Fixed amounts
+// come first, then the rest is divided by weight if any recipient has one, otherwise
+// by b.Strategy
+func (b *Batch) shares(amount Coin, recipients []Address) ([]Coin, error) {
+	destinations := map[Address]Destination{}
+	for _, destination := range b.Destinations {
+		destinations[destination.Address] = destination
+	}
+
+	shares := make([]Coin, len(recipients))
+	var others []int
+	weighted := false
+	rest := amount
+	for i, recipient := range recipients {
+		destination := destinations[recipient]
+		if destination.Amount == 0 {
+			others = append(others, i)
+			weighted = weighted || destination.Weight > 0
+			continue
+		}
+
+		var err error
+		shares[i] = destination.Amount
+		rest, err = rest.Sub(destination.Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rest < 0 {
+		return nil, fmt.Errorf("%w: fixed amounts don't fit in the %v left to pay out", ErrInvalidPlan, b.format(amount))
+	}
+	if rest > 0 && len(others) == 0 {
+		return nil, fmt.Errorf("%w: fixed amounts leave %v with nobody to pay it to", ErrInvalidPlan, b.format(rest))
+	}
+	if rest == 0 || len(others) == 0 {
+		return shares, nil
+	}
+
+	var split []Coin
+	var err error
+	if weighted {
+		weights := make([]int64, len(others))
+		for j, i := range others {
+			weights[j] = destinations[recipients[i]].Weight
+			if weights[j] == 0 {
+				weights[j] = 1
+			}
+		}
+		split, err = splitByWeight(rest, weights)
+	} else {
+		split, err = b.GeneratePayouts(rest, len(others))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for j, share := range split {
+		shares[others[j]] = share
+	}
+	return shares, nil
+}
+
+// splitByWeight divides amount in proportion to weights. The few units rounding
+// leaves over go one each to recipients picked at random
+func splitByWeight(amount Coin, weights []int64) ([]Coin, error) {
+	var total int64
+	for _, weight := range weights {
+		if weight > 0 && total > (1<<63-1)-weight {
+			return nil, ErrCoinOverflow
+		}
+		total += weight
+	}
+
+	split := make([]Coin, len(weights))
+	left := amount
+	for i, weight := range weights {
+		share, err := amount.MulRatio(weight, total)
+		if err != nil {
+			return nil, err
+		}
+		split[i] = share
+		left -= share
+	}
+
+	for _, i := range rand.Perm(len(split))[:left] {
+		split[i] += 1
+	}
+	return split, nil
+}
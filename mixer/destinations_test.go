@@ -0,0 +1,125 @@
+package mixer
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseDestination(t *testing.T) {
+	fmt.Println("Running TestParseDestination...")
+
+	cases := []struct {
+		s           string
+		destination Destination
+		valid       bool
+	}{
+		{"Bob", Destination{"Bob", 0, 0}, true},
+		{"Bob:70", Destination{"Bob", 70, 0}, true},
+		{"Bob=12.50", Destination{"Bob", 0, Coin(1250)}, true},
+		{"Bob:Cold:3", Destination{"Bob:Cold", 3, 0}, true},
+		{"Bob:0", Destination{}, false},
+		{"Bob:-1", Destination{}, false},
+		{"Bob:1.5", Destination{}, false},
+		{"Bob=0", Destination{}, false},
+		{"Bob=1.234", Destination{}, false},
+		{"=1.00", Destination{}, false},
+		{":3", Destination{}, false},
+	}
+
+	for _, c := range cases {
+		destination, err := ParseDestination(c.s, 2)
+		if c.valid && (err != nil || destination != c.destination) {
+			t.Errorf("Expected ParseDestination(%s) to return %v, saw %v and error %v", c.s, c.destination, destination, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("Expected ParseDestination(%s) to fail, saw %v", c.s, destination)
+		}
+	}
+}
+
+func TestMixerNewBatchDestinations(t *testing.T) {
+	fmt.Println("Running TestMixerNewBatchDestinations...")
+
+	ledger := &testLedger{}
+	mixer := NewMixer(ledger, nil)
+	amount := NewAmount(Coin(1000), DEFAULT_ASSET, DEFAULT_PRECISION) // a fee of 2.00
+
+	cases := []struct {
+		destinations []Destination
+		valid        bool
+	}{
+		{[]Destination{{"Bob", 0, Coin(500)}, {"Charles", 0, Coin(300)}}, true},
+		{[]Destination{{"Bob", 0, Coin(500)}, {"Charles", 0, 0}}, true},
+		{[]Destination{{"Bob", 0, Coin(800)}, {"Charles", 2, 0}}, true},
+		{[]Destination{{"Bob", 0, Coin(801)}, {"Charles", 0, 0}}, false},
+		{[]Destination{{"Bob", 0, Coin(500)}, {"Charles", 0, Coin(200)}}, false},
+		{[]Destination{{"Bob", 0, Coin(500)}, {"Bob", 0, 0}}, false},
+	}
+
+	for i, c := range cases {
+		_, err := mixer.NewBatch(NewWallet(ledger, Address(fmt.Sprintf("Tumbler-%d", i))), amount, c.destinations, 1, HalvingStrategy{})
+		if c.valid && err != nil {
+			t.Errorf("Expected destinations %v to be accepted, saw '%s'", c.destinations, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("Expected destinations %v to be rejected", c.destinations)
+		}
+	}
+}
+
+func TestBatchPlanDestinations(t *testing.T) {
+	fmt.Println("Running TestBatchPlanDestinations...")
+
+	ledger := &testLedger{}
+	mixer := NewMixer(ledger, nil)
+	destinations := []Destination{{"Cold", 3, 0}, {"Exchange", 1, 0}, {"Rent", 0, Coin(327)}}
+	batch, err := mixer.NewBatch(NewWallet(ledger, "Tumbler"), NewAmount(Coin(2000), DEFAULT_ASSET, DEFAULT_PRECISION), destinations, 1, HalvingStrategy{})
+	if err != nil {
+		t.Fatalf("Mixer.NewBatch returned unexpected error %s", err)
+	}
+	delays := 0
+	batch.DelayGenerator = func(maxDelay int) int {
+		delays += 1
+		return RandomDelay(maxDelay)
+	}
+
+	plan, err := batch.Plan(NewWallet(ledger, "Pool"))
+	if err != nil {
+		t.Fatalf("Batch.Plan returned unexpected error %s", err)
+	}
+
+	// 20.00 less a 4.00 fee and 3.27 of rent leaves 12.73, split 3 to 1
+	paid := map[Address]Coin{}
+	for _, payout := range plan.Payouts {
+		paid[payout.Recipient] += payout.Amount
+	}
+	if paid["Rent"] != Coin(327) || paid["Cold"]+paid["Exchange"] != Coin(1273) {
+		t.Errorf("Expected the fixed amount to be paid exactly and the rest by weight, saw %v", paid)
+	}
+	if paid["Cold"] < Coin(954) || paid["Cold"] > Coin(955) {
+		t.Errorf("Expected Cold to be paid three quarters of 12.73, saw %v", paid["Cold"].ToString())
+	}
+	if delays != len(plan.Payouts) {
+		t.Errorf("Expected every payout to get a random delay, saw %d delays for %d payouts", delays, len(plan.Payouts))
+	}
+
+	// a fixed amount that doesn't break into denominations is still paid in full
+	batch, _ = mixer.NewBatch(NewWallet(ledger, "Tumbler-2"), NewAmount(Coin(2000), DEFAULT_ASSET, DEFAULT_PRECISION), destinations, 1, HalvingStrategy{})
+	batch.Denominations, _ = NewDenominations([]Coin{Coin(100)}, REMAINDER_FEE)
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+	plan, err = batch.Plan(NewWallet(ledger, "Pool"))
+	if err != nil {
+		t.Fatalf("Batch.Plan returned unexpected error %s with denominations", err)
+	}
+	rent := Coin(0)
+	for _, payout := range plan.Payouts {
+		if payout.Recipient == "Rent" {
+			rent += payout.Amount
+		}
+	}
+	if rent != Coin(327) {
+		t.Errorf("Expected the fixed amount to be paid in full with change, saw %v", rent.ToString())
+	}
+}
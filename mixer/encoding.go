@@ -0,0 +1,110 @@
+package mixer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	ENCODING_FORM = "form"
+
+	CONTENT_TYPE_JSON = "application/json"
+	CONTENT_TYPE_FORM = "application/x-www-form-urlencoded"
+)
+
+// SendRequest holds exactly the fields the Jobcoin send endpoint expects. The ledger
+// timestamps transactions itself, so there's no timestamp here
+type SendRequest struct {
+	Source    Address `json:"fromAddress"`
+	Recipient Address `json:"toAddress"`
+	Amount    Coin    `json:"amount"`
+}
+
+// RequestEncoder turns a SendRequest into the body of a POST request
+type RequestEncoder interface {
+	ContentType() string
+	Encode(request SendRequest) (*bytes.Buffer, error)
+}
+
+// JSONEncoder writes amounts as strings with Precision decimal places
+type JSONEncoder struct {
+	Precision int
+}
+
+func (e JSONEncoder) ContentType() string {
+	return CONTENT_TYPE_JSON
+}
+
+func (e JSONEncoder) Encode(request SendRequest) (*bytes.Buffer, error) {
+	b, err := json.Marshal(map[string]string{
+		"fromAddress": string(request.Source),
+		"toAddress":   string(request.Recipient),
+		"amount":      request.Amount.Format(e.Precision),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(b), nil
+}
+
+type FormEncoder struct {
+	Precision int
+}
+
+func (e FormEncoder) ContentType() string {
+	return CONTENT_TYPE_FORM
+}
+
+func (e FormEncoder) Encode(request SendRequest) (*bytes.Buffer, error) {
+	values := url.Values{}
+	values.Set("fromAddress", string(request.Source))
+	values.Set("toAddress", string(request.Recipient))
+	values.Set("amount", request.Amount.Format(e.Precision))
+	return bytes.NewBufferString(values.Encode()), nil
+}
+
+// NewRequestEncoder returns the encoder for a Network's Encoding and Precision
+func NewRequestEncoder(encoding string, precision int) (RequestEncoder, error) {
+	switch encoding {
+	case ENCODING_JSON:
+		return JSONEncoder{precision}, nil
+	case ENCODING_FORM:
+		return FormEncoder{precision}, nil
+	}
+	return nil, fmt.Errorf("Unsupported request encoding '%s'", encoding)
+}
+
+// DecodeSendRequest is the server side of RequestEncoder. It reads a JSON or form
+// encoded send from r depending on its Content-Type, with the amount at precision
+func DecodeSendRequest(r *http.Request, precision int) (SendRequest, error) {
+	var request SendRequest
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), CONTENT_TYPE_FORM) {
+		err := r.ParseForm()
+		if err != nil {
+			return request, err
+		}
+
+		request.Source = Address(r.PostForm.Get("fromAddress"))
+		request.Recipient = Address(r.PostForm.Get("toAddress"))
+		request.Amount, err = ParseCoin(r.PostForm.Get("amount"), precision)
+		return request, err
+	}
+
+	var raw struct {
+		Source    Address         `json:"fromAddress"`
+		Recipient Address         `json:"toAddress"`
+		Amount    json.RawMessage `json:"amount"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&raw)
+	if err != nil {
+		return request, err
+	}
+	request.Source, request.Recipient = raw.Source, raw.Recipient
+	request.Amount, err = decodeCoin(raw.Amount, precision)
+	return request, err
+}
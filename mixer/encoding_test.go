@@ -0,0 +1,84 @@
+package mixer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRequestEncoders(t *testing.T) {
+	fmt.Println("Running TestRequestEncoders...")
+
+	request := SendRequest{"Alice", "Bob", Coin(1050)}
+
+	encoder, _ := NewRequestEncoder(ENCODING_JSON, DEFAULT_PRECISION)
+	payload, err := encoder.Encode(request)
+	if err != nil {
+		t.Fatalf("JSONEncoder.Encode returned unexpected error %s", err)
+	}
+
+	var fields map[string]string
+	json.Unmarshal(payload.Bytes(), &fields)
+	expected := map[string]string{"fromAddress": "Alice", "toAddress": "Bob", "amount": "10.50"}
+	if fmt.Sprint(fields) != fmt.Sprint(expected) || encoder.ContentType() != CONTENT_TYPE_JSON {
+		t.Errorf("JSONEncoder produced %s with content type %s", payload, encoder.ContentType())
+	}
+
+	encoder, _ = NewRequestEncoder(ENCODING_FORM, DEFAULT_PRECISION)
+	payload, err = encoder.Encode(request)
+	if err != nil {
+		t.Fatalf("FormEncoder.Encode returned unexpected error %s", err)
+	}
+
+	values, _ := url.ParseQuery(payload.String())
+	if len(values) != 3 || values.Get("fromAddress") != "Alice" || values.Get("toAddress") != "Bob" || values.Get("amount") != "10.50" {
+		t.Errorf("FormEncoder produced unexpected payload %s", payload)
+	}
+	if encoder.ContentType() != CONTENT_TYPE_FORM {
+		t.Errorf("FormEncoder has unexpected content type %s", encoder.ContentType())
+	}
+
+	_, err = NewRequestEncoder("xml", DEFAULT_PRECISION)
+	if err == nil {
+		t.Errorf("NewRequestEncoder returned an encoder for an unknown encoding")
+	}
+
+	// DecodeSendRequest reads back what each encoder writes, at the same precision
+	request = SendRequest{"Alice", "Bob", Coin(123456789)}
+	for _, encoding := range []string{ENCODING_JSON, ENCODING_FORM} {
+		encoder, _ = NewRequestEncoder(encoding, 8)
+		payload, _ = encoder.Encode(request)
+		r, _ := http.NewRequest("POST", "/send", payload)
+		r.Header.Set("Content-Type", encoder.ContentType())
+
+		decoded, err := DecodeSendRequest(r, 8)
+		if err != nil || decoded != request {
+			t.Errorf("Expected %s encoded %v to decode at a precision of 8, saw %v and error %v", encoding, request, decoded, err)
+		}
+	}
+}
+
+func TestJobcoinLedgerFormEncodedSend(t *testing.T) {
+	fmt.Println("Running TestJobcoinLedgerFormEncodedSend...")
+
+	sim := NewSimulator()
+	_, server := newSimulatedLedger(sim)
+	defer server.Close()
+
+	network := LocalNetwork().WithBaseURL(server.URL)
+	network.Encoding = ENCODING_FORM
+	ledger := NewJobcoinLedger(NewApiClient(), network)
+
+	sim.Mint("Alice", Coin(1000))
+	err := ledger.SendTransaction(context.Background(), "Alice", "Bob", Coin(250))
+	if err != nil {
+		t.Fatalf("Form encoded send failed with error %s", err)
+	}
+
+	if sim.Balance("Bob") != Coin(250) {
+		t.Errorf("Expected Bob to receive 2.50, saw %v", sim.Balance("Bob").ToString())
+	}
+}
@@ -0,0 +1,111 @@
+package mixer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Errors the Jobcoin API reports. A LedgerError wraps one of these when the response
+// could be classified, so callers can check for them with errors.Is
+var (
+	ErrInsufficientFunds = errors.New("Insufficient Funds")
+	ErrInvalidAddress    = errors.New("Invalid Address")
+	ErrRateLimited       = errors.New("Rate Limited")
+	ErrServerUnavailable = errors.New("Server Unavailable")
+)
+
+// LedgerError is returned by ApiClient when the ledger responds with a status other
+// than 200. Message is the error reported in the response body, if there was one
+type LedgerError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *LedgerError) Error() string {
+	message := fmt.Sprintf(
+		"%s request to url '%s' returned unexpected status code %d", e.Method, e.URL, e.StatusCode)
+	if e.Message != "" {
+		message = fmt.Sprintf("%s: %s", message, e.Message)
+	}
+	return message
+}
+
+func (e *LedgerError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient reports whether err is worth retrying later: the ledger was throttling
+// us or briefly unavailable, and the request itself wasn't at fault
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrRateLimited) ||
+		errors.Is(err, ErrServerUnavailable) ||
+		errors.Is(err, ErrCircuitOpen)
+}
+
+// IsUnknownOutcome reports whether a send that failed with err may have been made
+// anyway: the ledger failed while handling it, or the connection was lost before we
+// got its answer. The ledger has to be checked before such a send is made again
+func IsUnknownOutcome(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrServerUnavailable) ||
+		errors.Is(err, ErrInjectedFault) ||
+		errors.As(err, &netErr)
+}
+
+// Jobcoin reports errors as {"error": "Insufficient Funds"}, or with a map of
+// field names to messages when a parameter fails validation
+type errorBody struct {
+	Error json.RawMessage `json:"error"`
+}
+
+func errorMessage(body []byte) string {
+	var parsed errorBody
+	if json.Unmarshal(body, &parsed) != nil || len(parsed.Error) == 0 {
+		return ""
+	}
+
+	var message string
+	if json.Unmarshal(parsed.Error, &message) == nil {
+		return message
+	}
+
+	var fields map[string]interface{}
+	if json.Unmarshal(parsed.Error, &fields) == nil {
+		var messages []string
+		for field, value := range fields {
+			messages = append(messages, fmt.Sprintf("%s: %v", field, value))
+		}
+		return strings.Join(messages, ", ")
+	}
+
+	return string(parsed.Error)
+}
+
+func newLedgerError(method, url string, status int, body []byte) *LedgerError {
+	return classifyLedgerError(method, url, status, errorMessage(body))
+}
+
+func classifyLedgerError(method, url string, status int, message string) *LedgerError {
+	lowered := strings.ToLower(message)
+
+	var err error
+	switch {
+	case status == http.StatusTooManyRequests:
+		err = ErrRateLimited
+	case status >= 500:
+		err = ErrServerUnavailable
+	case strings.Contains(lowered, "insufficient"):
+		err = ErrInsufficientFunds
+	case strings.Contains(lowered, "address"):
+		err = ErrInvalidAddress
+	}
+
+	return &LedgerError{method, url, status, message, err}
+}
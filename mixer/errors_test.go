@@ -0,0 +1,187 @@
+package mixer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestApiClientTypedErrors(t *testing.T) {
+	fmt.Println("Running TestApiClientTypedErrors...")
+
+	cases := []struct {
+		status   int
+		body     interface{}
+		expected error
+	}{
+		{http.StatusUnprocessableEntity, map[string]string{"error": "Insufficient Funds"}, ErrInsufficientFunds},
+		{http.StatusUnprocessableEntity, map[string]interface{}{
+			"error": map[string]string{"toAddress": "Address is not valid"}}, ErrInvalidAddress},
+		{http.StatusBadRequest, map[string]string{"error": "Invalid Address"}, ErrInvalidAddress},
+		{http.StatusTooManyRequests, nil, ErrRateLimited},
+		{http.StatusServiceUnavailable, nil, ErrServerUnavailable},
+		{http.StatusBadGateway, map[string]string{"error": "Insufficient Funds"}, ErrServerUnavailable},
+		{http.StatusBadRequest, nil, nil},
+	}
+
+	sentinels := []error{ErrInsufficientFunds, ErrInvalidAddress, ErrRateLimited, ErrServerUnavailable}
+
+	for _, c := range cases {
+		tServer := httptest.NewServer(http.HandlerFunc(mockHandler(c.status, c.body)))
+		apiClient := newTestApiClient()
+
+		_, getErr := apiClient.JSONGetRequest(tServer.URL)
+		postErr := apiClient.JSONPostRequest(tServer.URL, bytes.NewBufferString(`{}`))
+		tServer.Close()
+
+		for _, err := range []error{getErr, postErr} {
+			var ledgerErr *LedgerError
+			if !errors.As(err, &ledgerErr) || ledgerErr.StatusCode != c.status {
+				t.Errorf("Expected a LedgerError with status %d, saw '%v' instead", c.status, err)
+				continue
+			}
+
+			for _, sentinel := range sentinels {
+				if errors.Is(err, sentinel) != (sentinel == c.expected) {
+					t.Errorf("Status %d with body %v: errors.Is(%v, %v) = %v",
+						c.status, c.body, err, sentinel, errors.Is(err, sentinel))
+				}
+			}
+		}
+	}
+}
+
+func TestBatchTumbleRetriesTransientErrors(t *testing.T) {
+	fmt.Println("Running TestBatchTumbleRetriesTransientErrors...")
+
+	attempts := 0
+	client := &testClient{
+		PostResponse: func(url string, payload *bytes.Buffer) error {
+			attempts += 1
+			if attempts == 1 {
+				return &LedgerError{"POST", url, http.StatusTooManyRequests, "", ErrRateLimited}
+			}
+			if attempts == 3 {
+				return &LedgerError{"POST", url, http.StatusUnprocessableEntity, "Insufficient Funds", ErrInsufficientFunds}
+			}
+			return nil
+		},
+	}
+	pool := &Wallet{NewJobcoinLedger(client, VictoryNetwork()), "Pool"}
+
+	batch := NewBatch(Coin(120), Coin(20), pool, []Address{"Bob", "Charles"}, 1)
+	batch.PollInterval = 0
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+
+	// the first payout goes through on the second attempt, the second one fails for good
+	err := batch.Tumble(pool)
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected Batch.Tumble to return ErrInsufficientFunds, saw '%v' instead", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 send attempts, saw %d", attempts)
+	}
+}
+
+// lossyLedger fails its next sends with a 502, after making them if made is set, and
+// its next lookups with the circuit breaker open
+type lossyLedger struct {
+	*testLedger
+	failures       int
+	made           bool
+	lookupFailures int
+	sends          int
+}
+
+func (l *lossyLedger) GetAddressInfo(ctx context.Context, address Address) (*AddressInfo, error) {
+	if l.lookupFailures > 0 {
+		l.lookupFailures -= 1
+		return nil, ErrCircuitOpen
+	}
+	return l.testLedger.GetAddressInfo(ctx, address)
+}
+
+func (l *lossyLedger) SendTransaction(ctx context.Context, source, recipient Address, amount Coin) error {
+	l.sends += 1
+	if l.failures == 0 {
+		return l.testLedger.SendTransaction(ctx, source, recipient, amount)
+	}
+
+	l.failures -= 1
+	if l.made {
+		l.testLedger.SendTransaction(ctx, source, recipient, amount)
+	}
+	return &LedgerError{"POST", "/api/transactions", http.StatusBadGateway, "", ErrServerUnavailable}
+}
+
+// a send that fails with a 5xx may have been made, so it's looked for on the ledger
+// before it's sent again
+func TestBatchSendUnknownOutcome(t *testing.T) {
+	fmt.Println("Running TestBatchSendUnknownOutcome...")
+
+	for _, made := range []bool{true, false} {
+		expectedSends := 2
+		if made {
+			expectedSends = 1
+		}
+
+		ledger := &lossyLedger{&testLedger{}, 1, made, 0, 0}
+		pool := NewWallet(ledger, "Pool")
+		batch := NewBatch(Coin(100), Coin(0), NewWallet(ledger, "Tumbler"), []Address{"Bob"}, 1)
+		batch.PollInterval = 0
+		batch.DelayGenerator = func(maxDelay int) int {
+			return 0
+		}
+
+		err := batch.Tumble(pool)
+		if err != nil {
+			t.Fatalf("Batch.Tumble returned unexpected error %s", err)
+		}
+		if len(ledger.txns) != 1 || ledger.sends != expectedSends || batch.Outbox.Intents[0].Status != PAYOUT_CONFIRMED {
+			t.Errorf("Expected the payout to be made once in %d sends, saw %v in %d sends", expectedSends, ledger.txns, ledger.sends)
+		}
+
+		// forwards are looked for in the pool's history
+		ledger = &lossyLedger{&testLedger{}, 1, made, 0, 0}
+		pool = NewWallet(ledger, "Pool")
+		batch = NewBatch(Coin(100), Coin(0), NewWallet(ledger, "Tumbler"), []Address{"Bob"}, 1)
+		batch.PollInterval = 0
+
+		deposit := &Transaction{time.Now(), "Alice", "Tumbler", Coin(100), DEFAULT_ASSET, 0}
+		forwards, _ := batch.startForwards(pool, []*Transaction{deposit})
+		credited, pending, err := batch.credit(context.Background(), pool, forwards)
+		if err != nil {
+			t.Fatalf("Batch.credit returned unexpected error %s", err)
+		}
+		if credited != Coin(100) || len(pending) != 0 || len(ledger.txns) != 1 || ledger.sends != expectedSends {
+			t.Errorf("Expected the deposit to be forwarded once in %d sends, saw %v in %d sends", expectedSends, ledger.txns, ledger.sends)
+		}
+	}
+}
+
+// a ledger too busy to be checked is checked again, rather than failing the batch
+func TestBatchSendUnknownOutcomeBusyLedger(t *testing.T) {
+	fmt.Println("Running TestBatchSendUnknownOutcomeBusyLedger...")
+
+	ledger := &lossyLedger{&testLedger{}, 1, true, 2, 0}
+	batch := NewBatch(Coin(100), Coin(0), NewWallet(ledger, "Tumbler"), []Address{"Bob"}, 1)
+	batch.PollInterval = 0
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+
+	err := batch.Tumble(NewWallet(ledger, "Pool"))
+	if err != nil {
+		t.Fatalf("Batch.Tumble returned unexpected error %s", err)
+	}
+	if len(ledger.txns) != 1 || ledger.sends != 1 || batch.Outbox.Intents[0].Status != PAYOUT_CONFIRMED {
+		t.Errorf("Expected the payout to be found once the ledger could be checked, saw %v in %d sends", ledger.txns, ledger.sends)
+	}
+}
@@ -0,0 +1,228 @@
+package mixer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type FaultKind int
+
+const (
+	FAULT_NONE          FaultKind = iota
+	FAULT_DROP                    // the request never reaches the ledger
+	FAULT_LOST_RESPONSE           // the ledger acts on the request but the caller sees an error
+	FAULT_STATUS                  // the ledger responds with Fault.StatusCode instead
+	FAULT_TRUNCATE                // the response body is cut in half
+	FAULT_DUPLICATE               // the last transaction in the response is repeated
+)
+
+var ErrInjectedFault = errors.New("Injected Fault")
+
+// Fault is what a FaultyClient does to a single request. Latency is added before
+// the request whatever its Kind
+type Fault struct {
+	Kind       FaultKind
+	Latency    time.Duration
+	StatusCode int
+}
+
+// FaultSchedule decides which Fault to inject into each request
+type FaultSchedule interface {
+	Next(method, url string) Fault
+}
+
+// ScriptedFaults injects its faults in order, one per request, then none at all
+type ScriptedFaults struct {
+	mutex  sync.Mutex
+	faults []Fault
+	next   int
+}
+
+func NewScriptedFaults(faults ...Fault) *ScriptedFaults {
+	return &ScriptedFaults{faults: faults}
+}
+
+func (s *ScriptedFaults) Next(method, url string) Fault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.next >= len(s.faults) {
+		return Fault{}
+	}
+	fault := s.faults[s.next]
+	s.next += 1
+	return fault
+}
+
+// RandomFaults picks a fault for each request with the given probabilities, from a
+// seeded RNG so a failing run can be reproduced. StatusCodes are chosen from at random
+// for FAULT_STATUS, and default to a 503
+type RandomFaults struct {
+	mutex         sync.Mutex
+	rng           *rand.Rand
+	MaxLatency    time.Duration
+	DropRate      float64
+	LostRate      float64
+	StatusRate    float64
+	TruncateRate  float64
+	DuplicateRate float64
+	StatusCodes   []int
+}
+
+func NewRandomFaults(seed int64) *RandomFaults {
+	return &RandomFaults{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (r *RandomFaults) Next(method, url string) Fault {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var fault Fault
+	if r.MaxLatency > 0 {
+		fault.Latency = time.Duration(r.rng.Int63n(int64(r.MaxLatency)))
+	}
+
+	roll := r.rng.Float64()
+	rates := []struct {
+		kind FaultKind
+		rate float64
+	}{
+		{FAULT_DROP, r.DropRate},
+		{FAULT_LOST_RESPONSE, r.LostRate},
+		{FAULT_STATUS, r.StatusRate},
+		{FAULT_TRUNCATE, r.TruncateRate},
+		{FAULT_DUPLICATE, r.DuplicateRate},
+	}
+	for _, candidate := range rates {
+		if roll < candidate.rate {
+			fault.Kind = candidate.kind
+			break
+		}
+		roll -= candidate.rate
+	}
+
+	if fault.Kind == FAULT_STATUS {
+		fault.StatusCode = http.StatusServiceUnavailable
+		if len(r.StatusCodes) > 0 {
+			fault.StatusCode = r.StatusCodes[r.rng.Intn(len(r.StatusCodes))]
+		}
+	}
+	return fault
+}
+
+// FaultyClient wraps a JSONClient and injects the faults its Schedule asks for, so the
+// mixer can be run against a slow, lossy or misbehaving ledger. Truncated and
+// duplicated responses only apply to GETs
+type FaultyClient struct {
+	client   JSONClient
+	Schedule FaultSchedule
+}
+
+func NewFaultyClient(client JSONClient, schedule FaultSchedule) *FaultyClient {
+	return &FaultyClient{
+		client,
+		schedule,
+	}
+}
+
+// inject waits out the fault's latency and returns an error if the request shouldn't
+// be passed on to the ledger at all
+func (f *FaultyClient) inject(ctx context.Context, method, url string, fault Fault) error {
+	err := sleepContext(ctx, fault.Latency)
+	if err != nil {
+		return err
+	}
+
+	switch fault.Kind {
+	case FAULT_DROP:
+		return fmt.Errorf("%s request to url '%s' was dropped: %w", method, url, ErrInjectedFault)
+	case FAULT_STATUS:
+		body, _ := json.Marshal(map[string]string{"error": http.StatusText(fault.StatusCode)})
+		return newLedgerError(method, url, fault.StatusCode, body)
+	}
+	return nil
+}
+
+func (f *FaultyClient) JSONGetRequest(url string) ([]byte, error) {
+	return f.JSONGetRequestContext(context.Background(), url)
+}
+
+func (f *FaultyClient) JSONGetRequestContext(ctx context.Context, url string) ([]byte, error) {
+	fault := f.Schedule.Next("GET", url)
+	err := f.inject(ctx, "GET", url, fault)
+	if err != nil {
+		return nil, err
+	}
+
+	byteStream, err := getContext(ctx, f.client, url)
+	if err != nil {
+		return byteStream, err
+	}
+
+	switch fault.Kind {
+	case FAULT_LOST_RESPONSE:
+		return nil, fmt.Errorf("Response from url '%s' was lost: %w", url, ErrInjectedFault)
+	case FAULT_TRUNCATE:
+		return byteStream[:len(byteStream)/2], nil
+	case FAULT_DUPLICATE:
+		return duplicateTransaction(byteStream), nil
+	}
+	return byteStream, nil
+}
+
+func (f *FaultyClient) JSONPostRequest(url string, payload *bytes.Buffer) error {
+	return f.JSONPostRequestContext(context.Background(), url, payload)
+}
+
+func (f *FaultyClient) JSONPostRequestContext(ctx context.Context, url string, payload *bytes.Buffer) error {
+	return f.PostRequestContext(ctx, url, CONTENT_TYPE_JSON, payload)
+}
+
+func (f *FaultyClient) PostRequestContext(ctx context.Context, url, contentType string, payload *bytes.Buffer) error {
+	fault := f.Schedule.Next("POST", url)
+	err := f.inject(ctx, "POST", url, fault)
+	if err != nil {
+		return err
+	}
+
+	err = postContext(ctx, f.client, url, contentType, payload)
+	if err == nil && fault.Kind == FAULT_LOST_RESPONSE {
+		return fmt.Errorf("Response from url '%s' was lost: %w", url, ErrInjectedFault)
+	}
+	return err
+}
+
+// duplicateTransaction repeats the last transaction in a transactions or address info
+// response. The transaction is copied as the ledger wrote it, since its amount is only
+// meaningful at the ledger's precision. Anything else is returned unchanged
+func duplicateTransaction(byteStream []byte) []byte {
+	var txns []json.RawMessage
+	if json.Unmarshal(byteStream, &txns) == nil {
+		if len(txns) == 0 {
+			return byteStream
+		}
+		b, err := json.Marshal(append(txns, txns[len(txns)-1]))
+		if err != nil {
+			return byteStream
+		}
+		return b
+	}
+
+	var info map[string]json.RawMessage
+	if json.Unmarshal(byteStream, &info) == nil && json.Unmarshal(info["transactions"], &txns) == nil && len(txns) > 0 {
+		info["transactions"], _ = json.Marshal(append(txns, txns[len(txns)-1]))
+		b, err := json.Marshal(info)
+		if err != nil {
+			return byteStream
+		}
+		return b
+	}
+	return byteStream
+}
@@ -0,0 +1,164 @@
+package mixer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFaultyClientScriptedFaults(t *testing.T) {
+	fmt.Println("Running TestFaultyClientScriptedFaults...")
+
+	ctx := context.Background()
+	sim := NewSimulator()
+	sim.Mint("Alice", Coin(1000))
+	_, server := newSimulatedLedger(sim)
+	defer server.Close()
+
+	schedule := NewScriptedFaults(
+		Fault{Kind: FAULT_DROP},
+		Fault{Kind: FAULT_LOST_RESPONSE},
+		Fault{Kind: FAULT_STATUS, StatusCode: http.StatusTooManyRequests},
+		Fault{Kind: FAULT_TRUNCATE},
+		Fault{Kind: FAULT_DUPLICATE, Latency: time.Duration(10) * time.Millisecond},
+	)
+	client := NewFaultyClient(NewApiClient(), schedule)
+	ledger := NewJobcoinLedger(client, LocalNetwork().WithBaseURL(server.URL))
+
+	// a dropped send never reaches the ledger
+	err := ledger.SendTransaction(ctx, "Alice", "Bob", Coin(100))
+	if !errors.Is(err, ErrInjectedFault) || sim.Balance("Bob") != 0 {
+		t.Errorf("Expected dropped send to fail without moving coins, saw %v and balance %v", err, sim.Balance("Bob"))
+	}
+
+	// a lost response fails even though the ledger made the send
+	err = ledger.SendTransaction(ctx, "Alice", "Bob", Coin(100))
+	if !errors.Is(err, ErrInjectedFault) || sim.Balance("Bob") != Coin(100) {
+		t.Errorf("Expected lost response to fail after moving coins, saw %v and balance %v", err, sim.Balance("Bob"))
+	}
+
+	_, err = ledger.GetTransactions(ctx)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected injected 429 to be classified as ErrRateLimited, saw %v", err)
+	}
+
+	_, err = ledger.GetTransactions(ctx)
+	if err == nil {
+		t.Errorf("Expected truncated response to fail to parse")
+	}
+
+	start := time.Now()
+	txns, err := ledger.GetTransactions(ctx)
+	if err != nil || len(txns) != 3 {
+		t.Errorf("Expected the last of 2 transactions to be duplicated, saw %v and error %v", txns, err)
+	}
+	if time.Since(start) < time.Duration(10)*time.Millisecond {
+		t.Errorf("Expected injected latency to delay the request")
+	}
+
+	// the script has run out, requests go through untouched
+	txns, err = ledger.GetTransactions(ctx)
+	if err != nil || len(txns) != 2 {
+		t.Errorf("Expected 2 transactions once the script ran out, saw %v and error %v", txns, err)
+	}
+}
+
+func TestRandomFaultsSeeded(t *testing.T) {
+	fmt.Println("Running TestRandomFaultsSeeded...")
+
+	newSchedule := func() *RandomFaults {
+		faults := NewRandomFaults(42)
+		faults.MaxLatency = time.Second
+		faults.DropRate = 0.2
+		faults.StatusRate = 0.2
+		faults.StatusCodes = []int{429, 500, 503}
+		return faults
+	}
+
+	first, second := newSchedule(), newSchedule()
+	for i := 0; i < 100; i++ {
+		a, b := first.Next("GET", "url"), second.Next("GET", "url")
+		if a != b {
+			t.Fatalf("Expected schedules with the same seed to agree, saw %v and %v at request %d", a, b, i)
+		}
+		if a.Kind == FAULT_STATUS && a.StatusCode == 0 {
+			t.Errorf("Expected FAULT_STATUS to carry a status code")
+		}
+	}
+}
+
+// the mixer should still pay out in full, and not lose coins, when the ledger is slow
+// and sometimes unavailable
+func TestMixerRunUnderFaults(t *testing.T) {
+	fmt.Println("Running TestMixerRunUnderFaults...")
+
+	sim := NewSimulator()
+	_, server := newSimulatedLedger(sim)
+	defer server.Close()
+
+	faults := NewRandomFaults(7)
+	faults.MaxLatency = time.Duration(5) * time.Millisecond
+	faults.StatusRate = 0.1
+	client := NewFaultyClient(NewApiClient(), faults)
+	ledger := NewJobcoinLedger(client, LocalNetwork().WithBaseURL(server.URL))
+
+	amount := Coin(1200)
+	fee := Coin(200)
+	source := NewWallet(ledger, NewAddresses(1)[0])
+	recipients := NewAddresses(4)
+
+	batch := NewBatch(amount, fee, source, recipients, 5)
+	batch.PollInterval = time.Duration(10) * time.Millisecond
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+
+	sim.Mint("Alice", amount)
+	sim.Send("Alice", source.Address, amount)
+
+	pool := func(ledger Ledger) *Wallet {
+		return NewWallet(ledger, "Pool")
+	}
+	watcher := NewWatcher(ledger)
+	watcher.PollInterval = time.Duration(10) * time.Millisecond
+	mixer := &Mixer{ledger, pool, []*Batch{batch}, &sync.WaitGroup{}, watcher, nil, nil, nil, nil}
+	mixer.Run()
+
+	paidOut := Coin(0)
+	for _, recipient := range recipients {
+		paidOut += sim.Balance(recipient)
+	}
+
+	if paidOut+sim.Balance("Pool")+sim.Balance(source.Address) != amount {
+		t.Errorf("Expected no coins to be lost, saw %v paid out, %v pooled and %v unforwarded",
+			paidOut, sim.Balance("Pool"), sim.Balance(source.Address))
+	}
+	if paidOut != amount-fee {
+		t.Errorf("Expected recipients to receive %v in total, saw %v instead", (amount - fee).ToString(), paidOut.ToString())
+	}
+}
+
+// a duplicated transaction is a byte for byte copy, whatever the ledger's precision
+func TestDuplicateTransactionPrecision(t *testing.T) {
+	fmt.Println("Running TestDuplicateTransactionPrecision...")
+
+	txn := `{"timestamp":"2019-01-01T00:00:00Z","fromAddress":"Alice","toAddress":"Bob","amount":"%s"}`
+	for _, amount := range []string{"5", "0.12345678"} {
+		copied := fmt.Sprintf(txn, amount)
+		expected := fmt.Sprintf("[%s,%s]", copied, copied)
+
+		duplicated := duplicateTransaction([]byte(fmt.Sprintf("[%s]", copied)))
+		if string(duplicated) != expected {
+			t.Errorf("Expected %s to be duplicated as is, saw %s", copied, duplicated)
+		}
+
+		duplicated = duplicateTransaction([]byte(fmt.Sprintf(`{"balance":"%s","transactions":[%s]}`, amount, copied)))
+		if string(duplicated) != fmt.Sprintf(`{"balance":"%s","transactions":%s}`, amount, expected) {
+			t.Errorf("Expected %s to be duplicated as is in the address info, saw %s", copied, duplicated)
+		}
+	}
+}
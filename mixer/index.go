@@ -0,0 +1,137 @@
+package mixer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type indexEntry struct {
+	Transaction *Transaction
+	Processed   bool
+}
+
+// TransactionIndex is the in-memory cache described in the README. Every Refresh
+// downloads the ledger once for all wallets, but only the transactions past the
+// previously seen offset are ingested. Transactions are immutable, so they are keyed
+// by recipient and kept until a wallet has processed them, at which point they can
+// be evicted. Wallets read their transactions from the index instead of the network.
+// The IDs of ingested transactions are remembered for Retention, so a transaction is
+// never indexed twice even if the ledger has to be read from the start again
+type TransactionIndex struct {
+	mutex   sync.Mutex
+	ledger  Ledger
+	offset  int // number of ledger transactions already ingested
+	entries map[Address][]*indexEntry
+	seen    map[string]time.Time // ID -> timestamp of every transaction ingested
+
+	// unprocessed transactions older than Retention are evicted too, otherwise
+	// deposits to addresses nobody is watching would pile up forever
+	Retention time.Duration
+}
+
+func NewTransactionIndex(ledger Ledger) *TransactionIndex {
+	return &TransactionIndex{
+		ledger:    ledger,
+		entries:   map[Address][]*indexEntry{},
+		seen:      map[string]time.Time{},
+		Retention: time.Duration(24) * time.Hour,
+	}
+}
+
+func (i *TransactionIndex) Refresh(ctx context.Context) error {
+	txns, err := i.ledger.GetTransactions(ctx)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	// the ledger is append only, so if it shrank the offset is meaningless and it
+	// has to be read from the start. Transactions already seen are skipped
+	if len(txns) < i.offset {
+		i.offset = 0
+	}
+
+	for _, txn := range txns[i.offset:] {
+		id := txn.ID()
+		if _, ok := i.seen[id]; ok {
+			continue
+		}
+		i.seen[id] = txn.Timestamp
+		i.entries[txn.Recipient] = append(i.entries[txn.Recipient], &indexEntry{txn, false})
+	}
+	i.offset = len(txns)
+
+	i.evict()
+	return nil
+}
+
+// Transactions returns the unprocessed transactions sent to address after cutoff and
+// marks them as processed, so each one is handed out exactly once
+func (i *TransactionIndex) Transactions(address Address, cutoff time.Time) []*Transaction {
+	var newTxns []*Transaction
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for _, entry := range i.entries[address] {
+		if entry.Processed || !entry.Transaction.Timestamp.After(cutoff) {
+			continue
+		}
+		entry.Processed = true
+		newTxns = append(newTxns, entry.Transaction)
+	}
+	return newTxns
+}
+
+// Fetcher lets a Batch read from the index in place of the ledger
+func (i *TransactionIndex) Fetcher() TransactionFetcher {
+	return func(ctx context.Context, w *Wallet, cutoff time.Time) ([]*Transaction, error) {
+		txns := i.Transactions(w.Address, cutoff)
+		for _, txn := range txns {
+			fmt.Printf("New txn seen: %v\n", txn)
+		}
+		return txns, nil
+	}
+}
+
+// Size returns the number of transactions currently held in the index
+func (i *TransactionIndex) Size() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	size := 0
+	for _, entries := range i.entries {
+		size += len(entries)
+	}
+	return size
+}
+
+// callers must hold i.mutex
+func (i *TransactionIndex) evict() {
+	expiry := time.Now().Add(-i.Retention)
+
+	for address, entries := range i.entries {
+		var unprocessed []*indexEntry
+		for _, entry := range entries {
+			if !entry.Processed && entry.Transaction.Timestamp.After(expiry) {
+				unprocessed = append(unprocessed, entry)
+			}
+		}
+
+		if len(unprocessed) == 0 {
+			delete(i.entries, address)
+		} else {
+			i.entries[address] = unprocessed
+		}
+	}
+
+	for id, timestamp := range i.seen {
+		if !timestamp.After(expiry) {
+			delete(i.seen, id)
+		}
+	}
+}
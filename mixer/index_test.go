@@ -0,0 +1,149 @@
+package mixer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLedger is an in-process Ledger that counts how often the full ledger is downloaded
+type testLedger struct {
+	mutex    sync.Mutex
+	txns     []*Transaction
+	getCalls int
+}
+
+func (l *testLedger) GetTransactions(ctx context.Context) ([]*Transaction, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.getCalls += 1
+	return append([]*Transaction{}, l.txns...), nil
+}
+
+func (l *testLedger) SendTransaction(ctx context.Context, source, recipient Address, amount Coin) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.txns = append(l.txns, &Transaction{time.Now(), source, recipient, amount, DEFAULT_ASSET, 0})
+	return nil
+}
+
+func (l *testLedger) GetBalance(ctx context.Context, address Address) (Coin, error) {
+	return Coin(0), fmt.Errorf("testLedger does not track balances")
+}
+
+// balances aren't tracked, only the transactions involving address are served
+func (l *testLedger) GetAddressInfo(ctx context.Context, address Address) (*AddressInfo, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	info := &AddressInfo{Balance: Coin(0)}
+	for _, txn := range l.txns {
+		if txn.Source == address || txn.Recipient == address {
+			info.Transactions = append(info.Transactions, txn)
+		}
+	}
+	return info, nil
+}
+
+func TestTransactionIndexRefresh(t *testing.T) {
+	fmt.Println("Running TestTransactionIndexRefresh...")
+
+	ctx := context.Background()
+	start := time.Now()
+	ledger := &testLedger{}
+	ledger.SendTransaction(ctx, "Alice", "Bob", Coin(100))
+	ledger.SendTransaction(ctx, "Alice", "Charles", Coin(200))
+
+	index := NewTransactionIndex(ledger)
+	err := index.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("TransactionIndex.Refresh returned unexpected error %s", err)
+	}
+
+	bob := &Wallet{ledger, "Bob"}
+	charles := &Wallet{ledger, "Charles"}
+	fetch := index.Fetcher()
+
+	bobTxns, _ := fetch(ctx, bob, start)
+	charlesTxns, _ := fetch(ctx, charles, start)
+	if len(bobTxns) != 1 || bobTxns[0].Amount != Coin(100) {
+		t.Errorf("Expected Bob to see a single transaction of 1.00, saw %v", bobTxns)
+	}
+	if len(charlesTxns) != 1 || charlesTxns[0].Amount != Coin(200) {
+		t.Errorf("Expected Charles to see a single transaction of 2.00, saw %v", charlesTxns)
+	}
+
+	// every wallet is served from memory, a single download covered both of them
+	if ledger.getCalls != 1 {
+		t.Errorf("Expected the ledger to be downloaded once, saw %d downloads", ledger.getCalls)
+	}
+
+	// processed transactions are never handed out twice
+	bobTxns, _ = fetch(ctx, bob, start)
+	if len(bobTxns) != 0 {
+		t.Errorf("Expected Bob's transaction to be processed already, saw %v", bobTxns)
+	}
+
+	// only the new tail of the ledger is ingested, and settled entries are evicted
+	ledger.SendTransaction(ctx, "Alice", "Bob", Coin(300))
+	index.Refresh(ctx)
+	if index.Size() != 1 {
+		t.Errorf("Expected only the new transaction to remain indexed, saw %d entries", index.Size())
+	}
+
+	bobTxns, _ = fetch(ctx, bob, start)
+	if len(bobTxns) != 1 || bobTxns[0].Amount != Coin(300) {
+		t.Errorf("Expected Bob to see a single new transaction of 3.00, saw %v", bobTxns)
+	}
+}
+
+func TestTransactionIndexRetention(t *testing.T) {
+	fmt.Println("Running TestTransactionIndexRetention...")
+
+	ledger := &testLedger{}
+	ledger.txns = []*Transaction{
+		&Transaction{time.Now().Add(time.Duration(-2) * time.Hour), "Alice", "Bob", Coin(100), DEFAULT_ASSET, 0},
+		&Transaction{time.Now(), "Alice", "Bob", Coin(200), DEFAULT_ASSET, 0},
+	}
+
+	index := NewTransactionIndex(ledger)
+	index.Retention = time.Hour
+	index.Refresh(context.Background())
+
+	if index.Size() != 1 {
+		t.Errorf("Expected the expired transaction to be evicted, saw %d entries", index.Size())
+	}
+}
+
+func TestTransactionIndexSkipsSeenTransactions(t *testing.T) {
+	fmt.Println("Running TestTransactionIndexSkipsSeenTransactions...")
+
+	ctx := context.Background()
+	start := time.Now()
+	ledger := &testLedger{}
+	ledger.SendTransaction(ctx, "Alice", "Bob", Coin(100))
+	ledger.SendTransaction(ctx, "Alice", "Bob", Coin(200))
+
+	index := NewTransactionIndex(ledger)
+	index.Refresh(ctx)
+	bob := index.Transactions("Bob", start)
+	if len(bob) != 2 {
+		t.Fatalf("Expected Bob to see 2 transactions, saw %v", bob)
+	}
+
+	// a shorter response forces the ledger to be read from the start again, but
+	// nothing already handed out is handed out twice
+	ledger.txns = ledger.txns[:1]
+	index.Refresh(ctx)
+	ledger.SendTransaction(ctx, "Alice", "Bob", Coin(300))
+	index.Refresh(ctx)
+
+	bob = index.Transactions("Bob", start)
+	if len(bob) != 1 || bob[0].Amount != Coin(300) {
+		t.Errorf("Expected Bob to see only the new transaction of 3.00, saw %v", bob)
+	}
+}
@@ -0,0 +1,273 @@
+package mixer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	JOURNAL_BATCH     = "batch"     // a batch was created
+	JOURNAL_FORWARD   = "forward"   // a deposit is about to be forwarded to the pool
+	JOURNAL_DEPOSIT   = "deposit"   // a deposit was forwarded to the pool
+	JOURNAL_INTENT    = "intent"    // a payout was planned, before it's sent
+	JOURNAL_PAYOUT    = "payout"    // a payout was sent to a recipient
+	JOURNAL_CONFIRMED = "confirmed" // a payout was found on the ledger
+	JOURNAL_EXPIRED   = "expired"   // a batch timed out before it was fully deposited
+	JOURNAL_DONE      = "done"      // every payout of a batch has been confirmed
+)
+
+// BatchParams is everything needed to recreate a Batch
+type BatchParams struct {
+	Amount     Coin          `json:"amount"`
+	Fee        Coin          `json:"fee"`
+	Asset      Asset         `json:"asset"`
+	Recipients []Address     `json:"recipients"`
+	StartTime  time.Time     `json:"startTime"`
+	Timeout    time.Duration `json:"timeout"`
+	Strategy   string        `json:"strategy,omitempty"`
+	Minimum    Coin          `json:"minimum,omitempty"` // see MinimumStrategy
+
+	Denominations *Denominations `json:"denominations,omitempty"`
+	Destinations  []Destination  `json:"destinations,omitempty"`
+}
+
+// JournalEntry is a single line of a Journal. Batches are identified by their
+// tumbler address, which is unique to each batch
+type JournalEntry struct {
+	Kind        string        `json:"kind"`
+	Batch       Address       `json:"batch"`
+	Time        time.Time     `json:"time"`
+	Params      *BatchParams  `json:"params,omitempty"`
+	Intent      *PayoutIntent `json:"intent,omitempty"`
+	IntentID    string        `json:"intentId,omitempty"`
+	Transaction string        `json:"transaction,omitempty"`
+	Recipient   Address       `json:"recipient,omitempty"`
+	Depositor   Address       `json:"depositor,omitempty"`
+	Pool        Address       `json:"pool,omitempty"`
+	Amount      Coin          `json:"amount,omitempty"`
+}
+
+// Journal is a write-ahead log of batches kept on local disk. Every entry is appended
+// as a line of JSON and synced before the call returns, so once a batch has recorded
+// something it survives the process dying immediately afterwards
+type Journal struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+// OpenJournal opens the journal at path, creating it if it doesn't exist. A partly
+// written last line, left by a crash in the middle of Append, is truncated away: the
+// Append it belonged to never returned, so nothing relied on it
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err == nil && len(b) > 0 && b[len(b)-1] != '\n' {
+		err = file.Truncate(int64(bytes.LastIndexByte(b, '\n') + 1))
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Journal{path: path, file: file}, nil
+}
+
+func (j *Journal) Append(entry *JournalEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	_, err = j.file.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.file.Close()
+}
+
+// BatchState is a batch as far as the journal knows it
+type BatchState struct {
+	Source   Address
+	Params   BatchParams
+	Deposits []string // IDs of the deposits forwarded to the pool
+	Forwards []*Forward
+	Credited Coin
+	Outbox   *Outbox
+	Expired  bool
+	Done     bool
+}
+
+// Replay reads back every batch recorded in the journal, in the order they were created
+func (j *Journal) Replay() ([]*BatchState, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	b, err := ioutil.ReadFile(j.path)
+	if err != nil {
+		return nil, err
+	}
+	// only complete lines count
+	b = b[:bytes.LastIndexByte(b, '\n')+1]
+
+	var states []*BatchState
+	batches := map[Address]*BatchState{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, len(b)+1)
+	for line := 1; scanner.Scan(); line++ {
+		var entry JournalEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse line %d of journal '%s': %s", line, j.path, err)
+		}
+
+		if entry.Kind == JOURNAL_BATCH {
+			if entry.Params == nil {
+				return nil, fmt.Errorf("Line %d of journal '%s' creates batch '%s' without params", line, j.path, entry.Batch)
+			}
+			state := &BatchState{Source: entry.Batch, Params: *entry.Params, Outbox: NewOutbox()}
+			batches[entry.Batch] = state
+			states = append(states, state)
+			continue
+		}
+
+		state, ok := batches[entry.Batch]
+		if !ok {
+			return nil, fmt.Errorf("Line %d of journal '%s' refers to unknown batch '%s'", line, j.path, entry.Batch)
+		}
+
+		switch entry.Kind {
+		case JOURNAL_FORWARD:
+			state.Forwards = append(state.Forwards, &Forward{
+				Deposit: entry.Transaction, Depositor: entry.Depositor, Pool: entry.Pool, Amount: entry.Amount, StartedAt: entry.Time})
+		case JOURNAL_DEPOSIT:
+			err = state.forwarded(line, j.path, entry.Transaction)
+			if err == nil {
+				state.Deposits = append(state.Deposits, entry.Transaction)
+				state.Credited, err = state.Credited.Add(entry.Amount)
+			}
+		case JOURNAL_INTENT:
+			if entry.Intent == nil {
+				return nil, fmt.Errorf("Line %d of journal '%s' plans a payout without an intent", line, j.path)
+			}
+			state.Outbox.Intents = append(state.Outbox.Intents, entry.Intent)
+		case JOURNAL_PAYOUT:
+			err = state.advance(line, j.path, entry.IntentID, PAYOUT_SENT, "")
+		case JOURNAL_CONFIRMED:
+			err = state.advance(line, j.path, entry.IntentID, PAYOUT_CONFIRMED, entry.Transaction)
+		case JOURNAL_EXPIRED:
+			state.Expired = true
+		case JOURNAL_DONE:
+			state.Done = true
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return states, scanner.Err()
+}
+
+// forwarded marks the forward of the deposit with the given ID as made
+func (s *BatchState) forwarded(line int, path, deposit string) error {
+	for _, f := range s.Forwards {
+		if f.Deposit == deposit {
+			f.Forwarded = true
+			return nil
+		}
+	}
+	return fmt.Errorf("Line %d of journal '%s' credits deposit '%s' that was never forwarded", line, path, deposit)
+}
+
+// advance moves the intent with the given ID on to status
+func (s *BatchState) advance(line int, path, id string, status PayoutStatus, txnID string) error {
+	intent := s.Outbox.find(id)
+	if intent == nil {
+		return fmt.Errorf("Line %d of journal '%s' refers to unknown payout '%s'", line, path, id)
+	}
+	intent.Status = status
+	if txnID != "" {
+		intent.Transaction = txnID
+	}
+	return nil
+}
+
+// Unfinished returns the batches in the journal that haven't confirmed all their payouts
+func (j *Journal) Unfinished() ([]*BatchState, error) {
+	states, err := j.Replay()
+	if err != nil {
+		return nil, err
+	}
+
+	var unfinished []*BatchState
+	for _, state := range states {
+		if !state.Done {
+			unfinished = append(unfinished, state)
+		}
+	}
+	return unfinished, nil
+}
+
+// Restore rebuilds the batch on ledger, picking up from where the journal says it
+// stopped. A batch still waiting for deposits gets a full Timeout from now, since
+// nobody could have seen its deposits while the process was down
+func (s *BatchState) Restore(ledger Ledger, journal *Journal) (*Batch, error) {
+	strategy, err := NewPayoutStrategy(s.Params.Strategy, s.Params.Minimum)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBatch(s.Params.Amount, s.Params.Fee, NewWallet(ledger, s.Source), s.Params.Recipients, 0)
+	b.Strategy = strategy
+	b.Denominations = s.Params.Denominations
+	if len(s.Params.Destinations) > 0 {
+		b.Destinations = s.Params.Destinations
+	}
+	b.Asset = s.Params.Asset
+	b.StartTime = s.Params.StartTime
+	b.Timeout = time.Since(s.Params.StartTime) + s.Params.Timeout
+	b.Deposits = NewDepositTracker(s.Source, s.Params.Asset, s.Params.StartTime)
+	b.Credited = s.Credited
+	b.Expired = s.Expired
+	for _, f := range s.Forwards {
+		if b.Pool == "" {
+			b.Pool = f.Pool
+		}
+		restored := *f
+		restored.unsure = true
+		b.Forwards = append(b.Forwards, &restored)
+		b.Deposits.MarkSeen(f.Deposit)
+	}
+	b.Journal = journal
+
+	for _, intent := range s.Outbox.Intents {
+		restored := *intent
+		restored.unsure = true
+		b.Outbox.Intents = append(b.Outbox.Intents, &restored)
+	}
+	b.useClaims(b.Claims)
+	return b, nil
+}
@@ -0,0 +1,196 @@
+package mixer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempJournal(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "apollo.journal"), func() { os.RemoveAll(dir) }
+}
+
+func TestJournalReplay(t *testing.T) {
+	fmt.Println("Running TestJournalReplay...")
+
+	path, cleanup := tempJournal(t)
+	defer cleanup()
+
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal returned unexpected error %s", err)
+	}
+	params := &BatchParams{
+		Amount:     Coin(1000),
+		Fee:        Coin(200),
+		Asset:      DEFAULT_ASSET,
+		Recipients: []Address{"Bob", "Charles"},
+		StartTime:  time.Now(),
+		Timeout:    time.Minute,
+		Strategy:   STRATEGY_HALVING,
+	}
+	bob := NewPayoutIntent("Tumbler-1", 0, "Pool", "Bob", Coin(300), time.Now())
+	charles := NewPayoutIntent("Tumbler-1", 1, "Pool", "Charles", Coin(500), time.Now())
+	entries := []*JournalEntry{
+		&JournalEntry{Kind: JOURNAL_BATCH, Batch: "Tumbler-1", Params: params},
+		&JournalEntry{Kind: JOURNAL_BATCH, Batch: "Tumbler-2", Params: params},
+		&JournalEntry{Kind: JOURNAL_FORWARD, Batch: "Tumbler-1", Transaction: "abc", Pool: "Pool", Amount: Coin(1000)},
+		&JournalEntry{Kind: JOURNAL_DEPOSIT, Batch: "Tumbler-1", Transaction: "abc", Pool: "Pool", Amount: Coin(1000)},
+		&JournalEntry{Kind: JOURNAL_FORWARD, Batch: "Tumbler-1", Transaction: "xyz", Pool: "Pool", Amount: Coin(500)},
+		&JournalEntry{Kind: JOURNAL_INTENT, Batch: "Tumbler-1", Intent: bob},
+		&JournalEntry{Kind: JOURNAL_INTENT, Batch: "Tumbler-1", Intent: charles},
+		&JournalEntry{Kind: JOURNAL_PAYOUT, Batch: "Tumbler-1", IntentID: bob.ID, Recipient: "Bob", Amount: Coin(300)},
+		&JournalEntry{Kind: JOURNAL_CONFIRMED, Batch: "Tumbler-1", IntentID: bob.ID, Transaction: "def"},
+		&JournalEntry{Kind: JOURNAL_DONE, Batch: "Tumbler-2"},
+	}
+	for _, entry := range entries {
+		journal.Append(entry)
+	}
+	journal.Close()
+
+	// a crash in the middle of an append leaves half a line behind
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"kind":"payout","batch":"Tumbler-1","recip`)
+	file.Close()
+
+	journal, err = OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal returned unexpected error for a torn journal: %s", err)
+	}
+	defer journal.Close()
+	journal.Append(&JournalEntry{Kind: JOURNAL_PAYOUT, Batch: "Tumbler-1", IntentID: charles.ID, Recipient: "Charles", Amount: Coin(500)})
+
+	unfinished, err := journal.Unfinished()
+	if err != nil {
+		t.Fatalf("Journal.Unfinished returned unexpected error %s", err)
+	}
+	if len(unfinished) != 1 || unfinished[0].Source != "Tumbler-1" {
+		t.Fatalf("Expected only Tumbler-1 to be unfinished, saw %v", unfinished)
+	}
+
+	state := unfinished[0]
+	if state.Credited != Coin(1000) || len(state.Deposits) != 1 || state.Deposits[0] != "abc" {
+		t.Errorf("Expected deposit abc of 10.00 to be replayed, saw %v and %v", state.Deposits, state.Credited)
+	}
+	if len(state.Forwards) != 2 || !state.Forwards[0].Forwarded || state.Forwards[1].Forwarded || state.Forwards[1].Pool != "Pool" {
+		t.Errorf("Expected deposit xyz to still be on its way to the pool, saw %v", state.Forwards)
+	}
+	if state.Params.Fee != Coin(200) {
+		t.Errorf("Expected params to be replayed, saw %v", state.Params)
+	}
+	intents := state.Outbox.Intents
+	if len(intents) != 2 || intents[0].Status != PAYOUT_CONFIRMED || intents[0].Transaction != "def" || intents[1].Status != PAYOUT_SENT {
+		t.Errorf("Expected Bob's payout to be confirmed and Charles' sent, saw %v", intents)
+	}
+
+	// a payout has to name the intent it was sent for
+	journal.Append(&JournalEntry{Kind: JOURNAL_PAYOUT, Batch: "Tumbler-1", Recipient: "Bob", Amount: Coin(300)})
+	_, err = journal.Replay()
+	if err == nil {
+		t.Errorf("Expected a payout without an intent to be rejected")
+	}
+}
+
+// crashingLedger cancels a run as soon as pool has sent its first payout
+type crashingLedger struct {
+	Ledger
+	pool   Address
+	cancel context.CancelFunc
+}
+
+func (l *crashingLedger) SendTransaction(ctx context.Context, source, recipient Address, amount Coin) error {
+	err := l.Ledger.SendTransaction(ctx, source, recipient, amount)
+	if source == l.pool {
+		l.cancel()
+	}
+	return err
+}
+
+// a mixer that dies between payouts picks up where it left off, without paying
+// anyone twice or crediting the deposit again
+func TestMixerResume(t *testing.T) {
+	fmt.Println("Running TestMixerResume...")
+
+	path, cleanup := tempJournal(t)
+	defer cleanup()
+
+	sim := NewSimulator()
+	ledger, server := newSimulatedLedger(sim)
+	defer server.Close()
+	pool := func(ledger Ledger) *Wallet {
+		return NewWallet(ledger, "Pool")
+	}
+
+	// the process "dies" right after the first payout
+	ctx, cancel := context.WithCancel(context.Background())
+	crashing := &crashingLedger{Ledger: ledger, pool: "Pool", cancel: cancel}
+
+	journal, _ := OpenJournal(path)
+	mixer := NewMixer(crashing, nil)
+	mixer.Pool = pool
+	mixer.Journal = journal
+	mixer.Watcher.PollInterval = time.Duration(10) * time.Millisecond
+
+	amount := Coin(1200)
+	recipients := NewAddresses(3)
+	source := NewWallet(crashing, NewAddresses(1)[0])
+	batch, err := mixer.NewBatch(source, NewAmount(amount, DEFAULT_ASSET, DEFAULT_PRECISION), NewDestinations(recipients), 5, HalvingStrategy{})
+	if err != nil {
+		t.Fatalf("Mixer.NewBatch returned unexpected error %s", err)
+	}
+	sim.Mint("Alice", amount)
+	sim.Send("Alice", source.Address, amount)
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+	mixer.RunContext(ctx)
+	journal.Close()
+
+	sent := 0
+	for _, intent := range batch.Outbox.Intents {
+		if intent.Status != PAYOUT_PLANNED {
+			sent += 1
+		}
+	}
+	if sent != 1 {
+		t.Fatalf("Expected exactly one payout before the crash, saw %v", batch.Outbox.Intents)
+	}
+
+	journal, _ = OpenJournal(path)
+	defer journal.Close()
+	mixer = NewMixer(ledger, nil)
+	mixer.Pool = pool
+	mixer.Journal = journal
+	mixer.Watcher.PollInterval = time.Duration(10) * time.Millisecond
+
+	resumed, err := mixer.Resume()
+	if err != nil || len(resumed) != 1 || resumed[0].Credited != amount {
+		t.Fatalf("Expected the batch to resume fully credited, saw %v and error %v", resumed, err)
+	}
+	resumed[0].DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+	mixer.Run()
+
+	paidOut := Coin(0)
+	for _, recipient := range recipients {
+		paidOut += sim.Balance(recipient)
+	}
+	if paidOut != amount-batch.Fee || sim.Balance("Pool") != batch.Fee {
+		t.Errorf("Expected %v paid out and %v pooled, saw %v and %v",
+			(amount - batch.Fee).ToString(), batch.Fee.ToString(), paidOut.ToString(), sim.Balance("Pool").ToString())
+	}
+
+	unfinished, _ := journal.Unfinished()
+	if len(unfinished) != 0 {
+		t.Errorf("Expected no unfinished batches once the resumed batch was done, saw %v", unfinished)
+	}
+}
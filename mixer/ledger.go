@@ -0,0 +1,176 @@
+package mixer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Ledger is the backend a Wallet reads from and writes to. JobcoinLedger talks to the
+// Jobcoin HTTP API, but anything that can list transactions, move coins and report a
+// balance can be plugged in instead
+type Ledger interface {
+	GetTransactions(ctx context.Context) ([]*Transaction, error)
+	SendTransaction(ctx context.Context, source, recipient Address, amount Coin) error
+	GetBalance(ctx context.Context, address Address) (Coin, error)
+	GetAddressInfo(ctx context.Context, address Address) (*AddressInfo, error)
+}
+
+type JobcoinLedger struct {
+	client  JSONClient
+	Network *Network
+}
+
+func NewJobcoinLedger(client JSONClient, network *Network) *JobcoinLedger {
+	return &JobcoinLedger{
+		client,
+		network,
+	}
+}
+
+func (l *JobcoinLedger) get(ctx context.Context, url string) ([]byte, error) {
+	return getContext(ctx, l.client, url)
+}
+
+func (l *JobcoinLedger) post(ctx context.Context, url, contentType string, payload *bytes.Buffer) error {
+	if _, ok := l.client.(PostClient); !ok && contentType != CONTENT_TYPE_JSON {
+		return fmt.Errorf("Client can't post '%s' requests required by network '%s'", contentType, l.Network.Name)
+	}
+	return postContext(ctx, l.client, url, contentType, payload)
+}
+
+// a ctx is only honored by clients that implement ContextJSONClient, otherwise it's
+// checked once before the request is made
+func getContext(ctx context.Context, client JSONClient, url string) ([]byte, error) {
+	if client, ok := client.(ContextJSONClient); ok {
+		return client.JSONGetRequestContext(ctx, url)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return client.JSONGetRequest(url)
+}
+
+// JSON bodies can go through any JSONClient, other encodings need a PostClient
+func postContext(ctx context.Context, client JSONClient, url, contentType string, payload *bytes.Buffer) error {
+	if client, ok := client.(PostClient); ok {
+		return client.PostRequestContext(ctx, url, contentType, payload)
+	}
+	if contentType != CONTENT_TYPE_JSON {
+		return fmt.Errorf("Client can't post '%s' requests", contentType)
+	}
+
+	if client, ok := client.(ContextJSONClient); ok {
+		return client.JSONPostRequestContext(ctx, url, payload)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return client.JSONPostRequest(url, payload)
+}
+
+func (l *JobcoinLedger) Asset() Asset {
+	return l.Network.Asset
+}
+
+func (l *JobcoinLedger) Precision() int {
+	return l.Network.Precision
+}
+
+func (l *JobcoinLedger) GetTransactions(ctx context.Context) ([]*Transaction, error) {
+	var txns []*Transaction
+
+	b, err := l.get(ctx, l.Network.TransactionsURL())
+	if err != nil {
+		return txns, err
+	}
+
+	var raw []*ledgerTransaction
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return txns, err
+	}
+
+	txns, err = l.decodeTransactions(raw)
+	AssignOccurrences(txns)
+	return txns, err
+}
+
+func (l *JobcoinLedger) SendTransaction(ctx context.Context, source, recipient Address, amount Coin) error {
+	encoder, err := NewRequestEncoder(l.Network.Encoding, l.Network.Precision)
+	if err != nil {
+		return err
+	}
+
+	payload, err := encoder.Encode(SendRequest{source, recipient, amount})
+	if err != nil {
+		return err
+	}
+
+	return l.post(ctx, l.Network.SendURL(), encoder.ContentType(), payload)
+}
+
+func (l *JobcoinLedger) GetBalance(ctx context.Context, address Address) (Coin, error) {
+	info, err := l.GetAddressInfo(ctx, address)
+	if err != nil {
+		return Coin(0), err
+	}
+	return info.Balance, nil
+}
+
+func (l *JobcoinLedger) GetAddressInfo(ctx context.Context, address Address) (*AddressInfo, error) {
+	info := &AddressInfo{}
+
+	b, err := l.get(ctx, l.Network.AddressURL(address))
+	if err != nil {
+		return info, err
+	}
+
+	var raw ledgerAddressInfo
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return info, err
+	}
+
+	info.Balance, err = decodeCoin(raw.Balance, l.Network.Precision)
+	if err != nil {
+		return info, err
+	}
+	info.Transactions, err = l.decodeTransactions(raw.Transactions)
+	AssignOccurrences(info.Transactions)
+	return info, err
+}
+
+// ledgerTransaction and ledgerAddressInfo are responses as the ledger writes them.
+// Amounts are kept raw until they can be parsed at the network's precision
+type ledgerTransaction struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Source    Address         `json:"fromAddress"`
+	Recipient Address         `json:"toAddress"`
+	Amount    json.RawMessage `json:"amount"`
+	Asset     Asset           `json:"asset"`
+}
+
+type ledgerAddressInfo struct {
+	Balance      json.RawMessage      `json:"balance"`
+	Transactions []*ledgerTransaction `json:"transactions"`
+}
+
+func (l *JobcoinLedger) decodeTransactions(raw []*ledgerTransaction) ([]*Transaction, error) {
+	var txns []*Transaction
+	for _, txn := range raw {
+		amount, err := decodeCoin(txn.Amount, l.Network.Precision)
+		if err != nil {
+			return txns, err
+		}
+		// ledgers that hold a single asset don't tag their transactions
+		asset := txn.Asset
+		if asset == "" {
+			asset = l.Network.Asset
+		}
+		txns = append(txns, &Transaction{txn.Timestamp, txn.Source, txn.Recipient, amount, asset, 0})
+	}
+	return txns, nil
+}
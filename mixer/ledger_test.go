@@ -0,0 +1,114 @@
+package mixer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJobcoinLedgerSendTransaction(t *testing.T) {
+	fmt.Println("Running TestJobcoinLedgerSendTransaction...")
+
+	ctx := context.Background()
+	var sentURL string
+	var sent Transaction
+	client := &testClient{
+		PostResponse: func(url string, payload *bytes.Buffer) error {
+			sentURL = url
+			return json.Unmarshal(payload.Bytes(), &sent)
+		},
+	}
+	ledger := NewJobcoinLedger(client, LocalNetwork().WithBaseURL("http://ledger"))
+
+	err := ledger.SendTransaction(ctx, "Alice", "Bob", Coin(250))
+	if err != nil {
+		t.Errorf("JobcoinLedger.SendTransaction returned unexpected error %s", err)
+	}
+
+	if sentURL != "http://ledger/send" {
+		t.Errorf("JobcoinLedger.SendTransaction posted to '%s', expected 'http://ledger/send'", sentURL)
+	}
+	if sent.Source != "Alice" || sent.Recipient != "Bob" || sent.Amount != Coin(250) {
+		t.Errorf("JobcoinLedger.SendTransaction posted unexpected transaction %v", sent)
+	}
+}
+
+func TestJobcoinLedgerGetAddressInfo(t *testing.T) {
+	fmt.Println("Running TestJobcoinLedgerGetAddressInfo...")
+
+	ctx := context.Background()
+	var requestedURL string
+	client := &testClient{
+		GetResponse: func(url string) ([]byte, error) {
+			requestedURL = url
+			return []byte(`{"balance":"7.50","transactions":[
+				{"timestamp":"2018-06-11T11:41:58.912Z","toAddress":"Alice","amount":"10"},
+				{"timestamp":"2018-06-11T11:42:58.912Z","fromAddress":"Alice","toAddress":"Bob","amount":"2.5"}
+			]}`), nil
+		},
+	}
+	ledger := NewJobcoinLedger(client, VictoryNetwork())
+
+	info, err := ledger.GetAddressInfo(ctx, "Alice")
+	if err != nil {
+		t.Fatalf("JobcoinLedger.GetAddressInfo returned unexpected error %s", err)
+	}
+	if requestedURL != VictoryNetwork().AddressURL("Alice") {
+		t.Errorf("JobcoinLedger.GetAddressInfo requested '%s', expected '%s'", requestedURL, VictoryNetwork().AddressURL("Alice"))
+	}
+	if info.Balance != Coin(750) || len(info.Transactions) != 2 {
+		t.Errorf("JobcoinLedger.GetAddressInfo returned unexpected info %v", info)
+	}
+	if info.Transactions[0].Source != "" || info.Transactions[1].Amount != Coin(250) {
+		t.Errorf("JobcoinLedger.GetAddressInfo did not parse transactions correctly: %v %v",
+			info.Transactions[0], info.Transactions[1])
+	}
+
+	balance, err := ledger.GetBalance(ctx, "Alice")
+	if err != nil || balance != Coin(750) {
+		t.Errorf("JobcoinLedger.GetBalance returned %v and error %v, expected 7.50", balance, err)
+	}
+}
+
+func TestJobcoinLedgerNetworkPrecision(t *testing.T) {
+	fmt.Println("Running TestJobcoinLedgerNetworkPrecision...")
+
+	ctx := context.Background()
+	var posted string
+	client := &testClient{
+		GetResponse: func(url string) ([]byte, error) {
+			return []byte(`[{"timestamp":"2018-06-11T11:41:58.912Z","toAddress":"Alice","amount":"0.00000001"},
+				{"timestamp":"2018-06-11T11:42:58.912Z","toAddress":"Alice","amount":1.5}]`), nil
+		},
+		PostResponse: func(url string, payload *bytes.Buffer) error {
+			posted = payload.String()
+			return nil
+		},
+	}
+	network := LocalNetwork()
+	network.Precision = 8
+	ledger := NewJobcoinLedger(client, network)
+
+	txns, err := ledger.GetTransactions(ctx)
+	if err != nil {
+		t.Fatalf("JobcoinLedger.GetTransactions returned unexpected error %s", err)
+	}
+	if txns[0].Amount != Coin(1) || txns[1].Amount != Coin(150000000) {
+		t.Errorf("Expected amounts to be parsed at a precision of 8, saw %v and %v", txns[0].Amount, txns[1].Amount)
+	}
+
+	ledger.SendTransaction(ctx, "Alice", "Bob", Coin(1))
+	if !strings.Contains(posted, `"amount":"0.00000001"`) {
+		t.Errorf("Expected the send to be encoded at a precision of 8, saw %s", posted)
+	}
+
+	// amounts finer than the network's precision are refused
+	network.Precision = 2
+	_, err = ledger.GetTransactions(ctx)
+	if err == nil {
+		t.Errorf("Expected an amount with excess precision to be rejected")
+	}
+}
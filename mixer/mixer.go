@@ -1,15 +1,35 @@
 package mixer
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"math/rand"
 	"sync"
 	"time"
 )
 
+const (
+	DEFAULT_POLL_INTERVAL = time.Duration(1) * time.Second
+	MAX_SEND_ATTEMPTS     = 5
+)
+
 type DelayGenerator func(int) int
 
+// TransactionFetcher returns the transactions sent to a wallet after cutoff.
+// FetchLedgerTransactions and FetchAddressTransactions both satisfy it
+type TransactionFetcher func(ctx context.Context, w *Wallet, cutoff time.Time) ([]*Transaction, error)
+
+// scan the whole ledger, see Wallet.GetTransactions
+func FetchLedgerTransactions(ctx context.Context, w *Wallet, cutoff time.Time) ([]*Transaction, error) {
+	return w.GetTransactionsContext(ctx, cutoff)
+}
+
+// use the ADDRESS INFO endpoint, see Wallet.GetAddressTransactions
+func FetchAddressTransactions(ctx context.Context, w *Wallet, cutoff time.Time) ([]*Transaction, error) {
+	return w.GetAddressTransactionsContext(ctx, cutoff)
+}
+
 func RandomDelay(maxDelay int) int {
 	rand.Seed(time.Now().UnixNano())
 	return rand.Intn(maxDelay)
@@ -18,109 +38,311 @@ func RandomDelay(maxDelay int) int {
 type Batch struct {
 	Amount         Coin
 	Fee            Coin
+	Asset          Asset
 	Source         *Wallet
 	Recipients     []Address
+	Destinations   []Destination // how much each of Recipients is paid
 	StartTime      time.Time
 	PollInterval   time.Duration
 	Timeout        time.Duration
 	DelayGenerator DelayGenerator
+	Strategy       PayoutStrategy
+	Denominations  *Denominations // nil pays out arbitrary amounts
+	Fetch          TransactionFetcher
+	Deposits       *DepositTracker
+
+	// progress so far, which the Journal keeps so the batch can resume after a crash
+	Credited Coin
+	Pool     Address // where the deposits were forwarded, which pays them out
+	Forwards []*Forward
+	Expired  bool // timed out before it was fully deposited, see expire
+	Outbox   *Outbox
+	Claims   *Claims // shared with every other batch of the same Mixer
+	Journal  *Journal
 }
 
 func NewBatch(amount, fee Coin, source *Wallet, recipients []Address, timeout int) *Batch {
+	startTime := time.Now()
+	asset := AssetOf(source.ledger)
 	return &Batch{
 		amount,
 		fee,
+		asset,
 		source,
 		recipients,
-		time.Now(),
-		time.Duration(1) * time.Second,
+		NewDestinations(recipients),
+		startTime,
+		DEFAULT_POLL_INTERVAL,
 		time.Duration(timeout) * time.Second,
 		RandomDelay,
+		HalvingStrategy{},
+		nil,
+		FetchAddressTransactions,
+		NewDepositTracker(source.Address, asset, startTime),
+		Coin(0),
+		"",
+		nil,
+		false,
+		NewOutbox(),
+		NewClaims(),
+		nil,
 	}
 }
 
-func (b *Batch) GeneratePayouts(amount Coin, totalRecipients int) []Coin {
-	rand.Seed(time.Now().UnixNano())
-	payouts := []Coin{}
-
-	for i := 0; i < totalRecipients; i++ {
-		if (i + 1) == totalRecipients {
-			payouts = append(payouts, amount)
-		} else {
-			// successively take a random integer payout between (1, n/2 + 1) from amount
-			// and update amount with the new value
-			upperBound := int(amount / 2)
-			if upperBound == 0 {
-				//if upperBound == 0 that imples amount was 1, so we can just add that
-				// payout value and early exit. Note that this implies that
-				// not every recipient account necessarily receives a payout
-				payouts = append(payouts, amount)
-				break
-			}
-			payout := Coin(rand.Intn(upperBound) + 1)
-			payouts = append(payouts, payout)
-			amount -= payout
-		}
+// record appends entry to b's journal, if it has one
+func (b *Batch) record(kind string, entry JournalEntry) error {
+	if b.Journal == nil {
+		return nil
+	}
+	entry.Kind = kind
+	entry.Batch = b.Source.Address
+	return b.Journal.Append(&entry)
+}
+
+func (b *Batch) params() *BatchParams {
+	return &BatchParams{
+		Amount:        b.Amount,
+		Fee:           b.Fee,
+		Asset:         b.Asset,
+		Recipients:    b.Recipients,
+		StartTime:     b.StartTime,
+		Timeout:       b.Timeout,
+		Strategy:      b.Strategy.Name(),
+		Minimum:       strategyMinimum(b.Strategy),
+		Denominations: b.Denominations,
+		Destinations:  b.Destinations,
+	}
+}
+
+// format writes amount with as many decimal places as b's ledger has
+func (b *Batch) format(amount Coin) string {
+	return b.Source.format(amount)
+}
+
+// GeneratePayouts splits amount between totalRecipients following b.Strategy
+func (b *Batch) GeneratePayouts(amount Coin, totalRecipients int) ([]Coin, error) {
+	payouts, err := b.Strategy.Split(amount, totalRecipients)
+	if err != nil {
+		return nil, fmt.Errorf("Splitting %v with the %s strategy: %s", b.format(amount), b.Strategy.Name(), err)
 	}
+	return payouts, nil
+}
 
-	return payouts
+func (b *Batch) Tumble(pool *Wallet) error {
+	return b.TumbleContext(context.Background(), pool)
 }
 
-func (b *Batch) Tumble(pool *Wallet) (err error) {
-	amount := b.Amount - b.Fee //keep b.Fee amount in the pool
-	totalRecipients := len(b.Recipients)
+// TumbleContext plans b's payouts and then executes the plan, see Plan and Execute
+func (b *Batch) TumbleContext(ctx context.Context, pool *Wallet) error {
+	plan, err := b.Plan(pool)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Payout plan for address '%s':\n%s\n", b.Source.Address, plan)
+
+	return b.Execute(ctx, pool)
+}
 
-	payouts := b.GeneratePayouts(amount, totalRecipients)
+// send retries a send the ledger throttled a few times before giving up. While the
+// circuit breaker is open payouts are paused, and waiting for it doesn't use up an
+// attempt. unsure is set for a send that may have been made without our knowing: it
+// was restored from a journal, or the ledger never answered it, see IsUnknownOutcome.
+// An unsure send is only made again once landed has looked for it on the ledger and
+// not found it, and a check the ledger was too busy for is made again without using
+// up an attempt. found reports that landed found the send, and has recorded it
+func (b *Batch) send(ctx context.Context, from *Wallet, recipient Address, amount Coin,
+	unsure *bool, landed func(context.Context) (bool, error)) (found bool, err error) {
+	for attempt := 1; attempt <= MAX_SEND_ATTEMPTS; {
+		if *unsure {
+			found, err = landed(ctx)
+			if found || (err != nil && (ctx.Err() != nil || !IsTransient(err))) {
+				return found, err
+			}
+			if err != nil {
+				fmt.Printf("Could not check whether the send to '%s' was made, checking again: %s\n", recipient, err)
+				if sleepErr := sleepContext(ctx, b.PollInterval); sleepErr != nil {
+					return false, sleepErr
+				}
+				continue
+			}
+		}
 
-	for i, payout := range payouts {
-		delay := time.Duration(b.DelayGenerator(10))
-		time.Sleep(delay * time.Second)
+		err = from.SendTransactionContext(ctx, recipient, amount)
+		switch {
+		case err == nil:
+			*unsure = false
+			return false, nil
+		case ctx.Err() != nil:
+			*unsure = *unsure || IsUnknownOutcome(err)
+			return false, err
+		case errors.Is(err, ErrCircuitOpen):
+			fmt.Printf("Ledger is unhealthy, pausing payout to '%s'\n", recipient)
+		case errors.Is(err, ErrRateLimited):
+			fmt.Printf("Sending to '%s' failed (attempt %d of %d): %s\n", recipient, attempt, MAX_SEND_ATTEMPTS, err)
+			attempt++
+		case IsUnknownOutcome(err):
+			fmt.Printf("Sending to '%s' failed (attempt %d of %d), checking whether it was made: %s\n",
+				recipient, attempt, MAX_SEND_ATTEMPTS, err)
+			*unsure = true
+			attempt++
+		default:
+			return false, err
+		}
 
-		err = pool.SendTransaction(b.Recipients[i], payout)
-		if err != nil {
-			return err
+		if sleepErr := sleepContext(ctx, b.PollInterval); sleepErr != nil {
+			return false, sleepErr
+		}
+	}
+	return false, err
+}
+
+// credit makes forwards, see forward. Forwards that hit a transient ledger error are
+// returned so they can be retried on the next poll, any other error aborts the batch
+func (b *Batch) credit(ctx context.Context, pool *Wallet, forwards []*Forward) (credited Coin, pending []*Forward, err error) {
+	for _, f := range forwards {
+		err = b.forward(ctx, pool, f)
+
+		switch {
+		case err == nil:
+			credited, err = credited.Add(f.Amount)
+			if err != nil {
+				return credited, pending, err
+			}
+		case ctx.Err() != nil:
+			return credited, pending, ctx.Err()
+		case IsTransient(err):
+			fmt.Printf("Could not forward deposit %s to the pool, will retry: %s\n", f.Deposit, err)
+			pending = append(pending, f)
+		default:
+			return credited, pending, err
 		}
 	}
+	return credited, pending, nil
+}
 
-	return err
+func (b *Batch) PollTransactions(pool *Wallet) error {
+	return b.PollTransactionsContext(context.Background(), pool)
 }
 
-func (b *Batch) PollTransactions(pool *Wallet) {
+// PollTransactionsContext returns ctx's error as soon as it's cancelled, without
+// forwarding any more deposits or sending pending payouts
+func (b *Batch) PollTransactionsContext(ctx context.Context, pool *Wallet) error {
 	fmt.Printf("b.StartTime: %s\nPolling address: %s\n", b.StartTime, b.Source.Address)
 
-	sum := Coin(0)
-	cutoff := b.StartTime            // look for new transactions after cutoff
-	timeout := cutoff.Add(b.Timeout) // exit if no new transactions are seen by timeout
+	sum := b.Credited
+	timeout := b.StartTime.Add(b.Timeout) // expire if the deposits aren't in by timeout
+	pending := b.pendingForwards()
+
+	if b.Expired {
+		return b.expire(ctx, pool)
+	}
+	if sum >= b.Amount {
+		return b.TumbleContext(ctx, pool)
+	}
 
 	for {
 		if timeout.Before(time.Now()) {
-			return
+			return b.expire(ctx, pool)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 
-		txns, err := b.Source.GetTransactions(cutoff)
-		cutoff = time.Now()
+		// the cutoff follows ledger timestamps, not the local clock
+		txns, err := b.Fetch(ctx, b.Source, b.Deposits.Cutoff())
+		if err != nil && (ctx.Err() != nil || !IsTransient(err)) {
+			return err
+		}
 		if err != nil {
-			log.Panic(err)
+			fmt.Printf("Could not poll address '%s', will retry: %s\n", b.Source.Address, err)
 		}
 
-		for _, txn := range txns {
-			b.Source.SendTransaction(pool.Address, txn.Amount)
-			sum += txn.Amount
+		forwards, err := b.startForwards(pool, b.Deposits.Track(txns))
+		if err != nil {
+			return err
+		}
+		var credited Coin
+		credited, pending, err = b.credit(ctx, pool, append(pending, forwards...))
+		if err != nil {
+			return err
+		}
+		sum, err = sum.Add(credited)
+		if err != nil {
+			return err
 		}
+		b.Credited = sum
 
 		if sum >= b.Amount {
-			b.Tumble(pool)
-			break
+			return b.TumbleContext(ctx, pool)
+		}
+
+		err = sleepContext(ctx, b.PollInterval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Watch is PollTransactionsContext for a batch whose deposits are delivered by a
+// Watcher instead of being polled by the batch itself
+func (b *Batch) Watch(ctx context.Context, pool *Wallet, deposits <-chan *Transaction) error {
+	fmt.Printf("b.StartTime: %s\nWatching address: %s\n", b.StartTime, b.Source.Address)
+
+	sum := b.Credited
+	timeout := time.NewTimer(time.Until(b.StartTime.Add(b.Timeout)))
+	defer timeout.Stop()
+	pending := b.pendingForwards()
+
+	if b.Expired {
+		return b.expire(ctx, pool)
+	}
+
+	for sum < b.Amount {
+		var txns []*Transaction
+
+		// only wake up to retry deposits when there are some waiting to be forwarded
+		var retry <-chan time.Time
+		if len(pending) > 0 {
+			retry = time.After(b.PollInterval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return b.expire(ctx, pool)
+		case <-retry:
+		case txn := <-deposits:
+			txns = b.Deposits.Track([]*Transaction{txn})
+			if len(txns) == 0 {
+				continue
+			}
+			fmt.Printf("New txn seen: %v\n", txn)
 		}
 
-		time.Sleep(b.PollInterval)
+		forwards, err := b.startForwards(pool, txns)
+		if err != nil {
+			return err
+		}
+		credited, stillPending, err := b.credit(ctx, pool, append(pending, forwards...))
+		if err != nil {
+			return err
+		}
+		pending = stillPending
+		sum, err = sum.Add(credited)
+		if err != nil {
+			return err
+		}
+		b.Credited = sum
 	}
+
+	return b.TumbleContext(ctx, pool)
 }
 
-type PoolStrategy func() *Wallet
+type PoolStrategy func(Ledger) *Wallet
 
 // generate a new Pool address every hour
-func HourlyPool() *Wallet {
+func HourlyPool(ledger Ledger) *Wallet {
 	now := time.Now()
 	address := fmt.Sprintf(
 		"Pool-%v-%v-%v-%v",
@@ -128,33 +350,195 @@ func HourlyPool() *Wallet {
 	)
 
 	fmt.Println("Address is ", address)
-	return NewWallet(Address(address))
+	return NewWallet(ledger, Address(address))
 }
 
+// Mixer runs batches of any asset it has an AssetConfig for. Ledger, Pool and Watcher
+// handle the asset of Ledger unless Assets says otherwise
 type Mixer struct {
+	Ledger    Ledger
 	Pool      PoolStrategy
 	Batches   []*Batch
 	WaitGroup *sync.WaitGroup
+	Watcher   *Watcher
+	Assets    map[Asset]*AssetConfig
+	Journal   *Journal // if set, batches are recorded here and can be resumed
+
+	// if set, every batch of Ledger's asset pays out in these denominations, so its
+	// payouts look like those of every other batch
+	Denominations *Denominations
+
+	// the ledger transactions that confirm the sends of every batch, see Claims
+	Claims *Claims
 }
 
-func NewMixer(batches []*Batch) *Mixer {
+func NewMixer(ledger Ledger, batches []*Batch) *Mixer {
 	return &Mixer{
+		ledger,
 		HourlyPool,
 		batches,
 		&sync.WaitGroup{},
+		NewWatcher(ledger),
+		map[Asset]*AssetConfig{},
+		nil,
+		nil,
+		NewClaims(),
+	}
+}
+
+// AddAsset lets m mix asset, pooling it and charging fees as config says
+func (m *Mixer) AddAsset(asset Asset, config *AssetConfig) {
+	if m.Assets == nil {
+		m.Assets = map[Asset]*AssetConfig{}
+	}
+	m.Assets[asset] = config
+}
+
+func (m *Mixer) config(asset Asset) (*AssetConfig, error) {
+	if config, ok := m.Assets[asset]; ok {
+		return config, nil
+	}
+	if asset == AssetOf(m.Ledger) {
+		return &AssetConfig{m.Ledger, m.Pool, PercentFee(DEFAULT_FEE_PERCENT), m.Watcher, m.Denominations}, nil
+	}
+	return nil, fmt.Errorf("%w: mixer isn't configured for asset '%s'", ErrAssetMismatch, asset)
+}
+
+// NewBatch adds a batch tumbling amount from source to destinations, with the fee set
+// by the schedule for amount's asset and the payouts that aren't fixed or weighted
+// split by strategy. source has to hold the same asset
+func (m *Mixer) NewBatch(source *Wallet, amount Amount, destinations []Destination, timeout int, strategy PayoutStrategy) (*Batch, error) {
+	if asset := AssetOf(source.ledger); asset != amount.Asset {
+		return nil, fmt.Errorf("%w: can't tumble %s %s through a %s wallet", ErrAssetMismatch, source.format(amount.Value), amount.Asset, asset)
+	}
+
+	config, err := m.config(amount.Asset)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, err := config.Fee(amount.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkDestinations(destinations, amount.Value, fee, PrecisionOf(source.ledger))
+	if err != nil {
+		return nil, err
+	}
+
+	batch := NewBatch(amount.Value, fee, source, destinationAddresses(destinations), timeout)
+	batch.Destinations = destinations
+	batch.Strategy = strategy
+	batch.Denominations = config.Denominations
+	batch.Journal = m.Journal
+
+	// Plan only runs once the deposits are in the pool, so a batch that can't be
+	// paid out has to be turned down before anyone is told where to deposit
+	err = batch.checkPayouts()
+	if err != nil {
+		return nil, err
+	}
+
+	err = batch.record(JOURNAL_BATCH, JournalEntry{Params: batch.params()})
+	if err != nil {
+		return nil, err
+	}
+
+	m.Batches = append(m.Batches, batch)
+	return batch, nil
+}
+
+// Resume adds every batch m.Journal has that hasn't finished its payouts, so they
+// carry on from where they stopped when RunContext is called
+func (m *Mixer) Resume() ([]*Batch, error) {
+	if m.Journal == nil {
+		return nil, nil
+	}
+
+	states, err := m.Journal.Replay()
+	if err != nil {
+		return nil, err
+	}
+	if m.Claims == nil {
+		m.Claims = NewClaims()
+	}
+
+	var resumed []*Batch
+	for _, state := range states {
+		// a finished batch's payouts still can't confirm anyone else's
+		if state.Done {
+			m.Claims.Add(state.Outbox.Intents...)
+			continue
+		}
+
+		config, err := m.config(state.Params.Asset)
+		if err != nil {
+			return resumed, err
+		}
+
+		batch, err := state.Restore(config.Ledger, m.Journal)
+		if err != nil {
+			return resumed, err
+		}
+		fmt.Printf("Resuming batch for address '%s', %v of %v credited\n",
+			batch.Source.Address, batch.format(batch.Credited), batch.format(batch.Amount))
+		m.Batches = append(m.Batches, batch)
+		resumed = append(resumed, batch)
 	}
+	return resumed, nil
 }
 
 func (m *Mixer) Run() {
+	m.RunContext(context.Background())
+}
+
+// RunContext returns once every batch has finished, or as soon as ctx is cancelled,
+// in which case polling stops and no further payouts are sent
+func (m *Mixer) RunContext(ctx context.Context) {
 	wg := m.WaitGroup
-	pool := m.Pool()
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// every asset has its own pool, and every batch of an asset is fed by the same
+	// poll loop instead of downloading the ledger itself
+	pools := map[Asset]*Wallet{}
+	watchers := map[*Watcher]bool{}
+	if m.Claims == nil {
+		m.Claims = NewClaims()
+	}
 	for _, b := range m.Batches {
+		if b.Claims != m.Claims {
+			b.useClaims(m.Claims)
+		}
+
+		config, err := m.config(b.Asset)
+		if err != nil {
+			fmt.Printf("Batch for address '%s' failed: %s\n", b.Source.Address, err)
+			continue
+		}
+		if _, ok := pools[b.Asset]; !ok {
+			pools[b.Asset] = config.Pool(config.Ledger)
+		}
+		pool := pools[b.Asset]
+		watcher := config.Watcher
+		watchers[watcher] = true
+		deposits := watcher.Subscribe(b.Source.Address)
+
 		wg.Add(1)
 		go func(b *Batch) {
-			b.PollTransactions(pool)
+			err := b.Watch(ctx, pool, deposits)
+			if err != nil {
+				fmt.Printf("Batch for address '%s' failed: %s\n", b.Source.Address, err)
+			}
+			watcher.Unsubscribe(b.Source.Address, deposits)
 			wg.Done()
 		}(b)
 	}
+
+	for watcher := range watchers {
+		go watcher.Run(ctx)
+	}
 	wg.Wait()
 }
@@ -2,9 +2,12 @@ package mixer
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"sync"
 	"testing"
 	"time"
@@ -15,7 +18,7 @@ func TestBatchGeneratePayouts(t *testing.T) {
 
 	amount := Coin(120)
 	fee := Coin(20)
-	source := NewWallet(Address("Address-1"))
+	source := NewWallet(NewJobcoinLedger(NewApiClient(), VictoryNetwork()), Address("Address-1"))
 	recipients := []Address{
 		Address("Address-1"), Address("Address-2"),
 	}
@@ -25,7 +28,10 @@ func TestBatchGeneratePayouts(t *testing.T) {
 	expected := amount - fee
 	actual := Coin(0)
 
-	payouts := batch.GeneratePayouts(expected, len(recipients))
+	payouts, err := batch.GeneratePayouts(expected, len(recipients))
+	if err != nil {
+		t.Fatalf("Batch.GeneratePayouts returned unexpected error %s", err)
+	}
 	for _, value := range payouts {
 		actual += value
 	}
@@ -40,9 +46,10 @@ func TestBatchGeneratePayouts(t *testing.T) {
 func TestNewMixer(t *testing.T) {
 	fmt.Println("Running TestNewMixer...")
 
-	mixer := NewMixer([]*Batch{})
-	expected := HourlyPool().Address
-	actual := mixer.Pool().Address
+	ledger := NewJobcoinLedger(NewApiClient(), VictoryNetwork())
+	mixer := NewMixer(ledger, []*Batch{})
+	expected := HourlyPool(ledger).Address
+	actual := mixer.Pool(mixer.Ledger).Address
 
 	if actual != expected {
 		t.Errorf("Mixer should've returned hour scoped pool address '%v'. Saw %v instead.", expected, actual)
@@ -62,6 +69,8 @@ func TestMixerRun(t *testing.T) {
 			"Alice",
 			"Bob",
 			amount,
+			DEFAULT_ASSET,
+			0,
 		},
 	}
 
@@ -77,7 +86,7 @@ func TestMixerRun(t *testing.T) {
 			return nil
 		},
 	}
-	w := &Wallet{client, "Bob"}
+	w := &Wallet{NewJobcoinLedger(client, VictoryNetwork()), "Bob"}
 	recipients := NewAddresses(rand.Intn(10) + 1)
 
 	batch := NewBatch(120, 20, w, recipients, 1)
@@ -87,16 +96,28 @@ func TestMixerRun(t *testing.T) {
 	batches := []*Batch{batch}
 
 	poolPostCalls := 0
-	poolGenerator := func() *Wallet {
+	var payouts []*Transaction
+	poolGenerator := func(Ledger) *Wallet {
 		poolClient := &testClient{
+			// serve the payouts back so they can be confirmed
+			GetResponse: func(url string) ([]byte, error) {
+				return json.Marshal(&AddressInfo{Coin(0), payouts})
+			},
 			PostResponse: func(url string, payload *bytes.Buffer) error {
 				poolPostCalls += 1
+				r, _ := http.NewRequest("POST", url, payload)
+				r.Header.Set("Content-Type", CONTENT_TYPE_FORM)
+				request, err := DecodeSendRequest(r, DEFAULT_PRECISION)
+				if err != nil {
+					return err
+				}
+				payouts = append(payouts, &Transaction{time.Now(), request.Source, request.Recipient, request.Amount, DEFAULT_ASSET, 0})
 				return nil
 			},
 		}
-		return &Wallet{poolClient, "Pool"}
+		return &Wallet{NewJobcoinLedger(poolClient, VictoryNetwork()), "Pool"}
 	}
-	mixer := &Mixer{poolGenerator, batches, &sync.WaitGroup{}}
+	mixer := &Mixer{w.ledger, poolGenerator, batches, &sync.WaitGroup{}, NewWatcher(w.ledger), nil, nil, nil, nil}
 
 	mixer.Run() // use recover/panic behavior here
 
@@ -111,3 +132,54 @@ func TestMixerRun(t *testing.T) {
 		t.Errorf("Expected poolPostCalls to have a value of %d for recipients: %v. Saw '%d' instead.", poolPostCalls, recipients, len(recipients))
 	}
 }
+
+func TestMixerRunContextCancel(t *testing.T) {
+	fmt.Println("Running TestMixerRunContextCancel...")
+
+	ledger := &testLedger{}
+	source := NewWallet(ledger, NewAddresses(1)[0])
+
+	// the deposit never arrives, so only cancellation can stop this batch early
+	batch := NewBatch(Coin(120), Coin(20), source, NewAddresses(2), 60)
+	mixer := NewMixer(ledger, []*Batch{batch})
+	mixer.Pool = func(ledger Ledger) *Wallet {
+		return NewWallet(ledger, "Pool")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(50)*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		mixer.RunContext(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(TIMEOUT):
+		t.Errorf("Mixer.RunContext did not return after its context expired")
+	}
+}
+
+func TestBatchTumbleContextCancel(t *testing.T) {
+	fmt.Println("Running TestBatchTumbleContextCancel...")
+
+	ledger := &testLedger{}
+	pool := NewWallet(ledger, "Pool")
+	batch := NewBatch(Coin(120), Coin(20), pool, NewAddresses(3), 1)
+	batch.DelayGenerator = func(maxDelay int) int {
+		return maxDelay
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := batch.TumbleContext(ctx, pool)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Batch.TumbleContext to return context.Canceled, saw '%v' instead", err)
+	}
+	if len(ledger.txns) != 0 {
+		t.Errorf("Expected no payouts after cancellation, saw %d", len(ledger.txns))
+	}
+}
@@ -0,0 +1,98 @@
+package mixer
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	DEFAULT_NETWORK = "victory"
+	ENCODING_JSON   = "json"
+)
+
+// Network describes a Jobcoin deployment: where its API lives, how send requests are
+// encoded, which asset it holds and how many decimal places its coins have. Every
+// JobcoinLedger carries its own Network, so one process can talk to several
+// deployments at once
+type Network struct {
+	Name             string
+	BaseURL          string
+	TransactionsPath string
+	AddressesPath    string
+	SendPath         string
+	Encoding         string
+	Precision        int
+	Asset            Asset
+}
+
+// the public Gemini deployment Apollo was written against
+func VictoryNetwork() *Network {
+	return &Network{
+		"victory",
+		"http://jobcoin.gemini.com/victory",
+		"/api/transactions",
+		"/api/addresses/",
+		"/send",
+		ENCODING_FORM,
+		2,
+		DEFAULT_ASSET,
+	}
+}
+
+// a server started with `apollo jobcoind` using its default settings
+func LocalNetwork() *Network {
+	return &Network{
+		"local",
+		"http://localhost:8080",
+		SIMULATOR_TXNS_PATH,
+		SIMULATOR_ADDRESSES_PATH,
+		SIMULATOR_SEND_PATH,
+		ENCODING_JSON,
+		2,
+		DEFAULT_ASSET,
+	}
+}
+
+var networks = map[string]func() *Network{
+	"victory": VictoryNetwork,
+	"local":   LocalNetwork,
+}
+
+// NewNetwork returns a fresh copy of the built-in profile called name
+func NewNetwork(name string) (*Network, error) {
+	profile, ok := networks[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown network '%s', expected one of: %s", name, strings.Join(NetworkNames(), ", "))
+	}
+	return profile(), nil
+}
+
+func NetworkNames() []string {
+	var names []string
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithBaseURL returns a copy of n served from baseURL instead
+func (n *Network) WithBaseURL(baseURL string) *Network {
+	network := *n
+	network.BaseURL = strings.TrimSuffix(baseURL, "/")
+	return &network
+}
+
+func (n *Network) TransactionsURL() string {
+	return n.BaseURL + n.TransactionsPath
+}
+
+func (n *Network) SendURL() string {
+	return n.BaseURL + n.SendPath
+}
+
+func (n *Network) AddressURL(address Address) string {
+	return n.BaseURL + n.AddressesPath + url.PathEscape(string(address))
+}
@@ -0,0 +1,88 @@
+package mixer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestNewNetwork(t *testing.T) {
+	fmt.Println("Running TestNewNetwork...")
+
+	cases := []struct {
+		name         string
+		transactions string
+		address      string
+		send         string
+	}{
+		{
+			"victory",
+			"http://jobcoin.gemini.com/victory/api/transactions",
+			"http://jobcoin.gemini.com/victory/api/addresses/Alice",
+			"http://jobcoin.gemini.com/victory/send",
+		},
+		{
+			"local",
+			"http://localhost:8080/api/transactions",
+			"http://localhost:8080/api/addresses/Alice",
+			"http://localhost:8080/send",
+		},
+	}
+
+	for _, c := range cases {
+		network, err := NewNetwork(c.name)
+		if err != nil {
+			t.Errorf("NewNetwork(%s) returned unexpected error %s", c.name, err)
+			continue
+		}
+
+		if network.TransactionsURL() != c.transactions ||
+			network.AddressURL("Alice") != c.address ||
+			network.SendURL() != c.send {
+			t.Errorf("Network '%s' has unexpected urls %s, %s and %s",
+				c.name, network.TransactionsURL(), network.AddressURL("Alice"), network.SendURL())
+		}
+	}
+
+	_, err := NewNetwork("mainnet")
+	if err == nil {
+		t.Errorf("NewNetwork returned a profile for an unknown network")
+	}
+}
+
+func TestNetworkWithBaseURL(t *testing.T) {
+	fmt.Println("Running TestNetworkWithBaseURL...")
+
+	network := LocalNetwork()
+	moved := network.WithBaseURL("http://127.0.0.1:9000/")
+
+	if moved.SendURL() != "http://127.0.0.1:9000/send" {
+		t.Errorf("Expected moved network to send to http://127.0.0.1:9000/send, saw %s", moved.SendURL())
+	}
+	if network.SendURL() != "http://localhost:8080/send" {
+		t.Errorf("WithBaseURL modified the original network, which now sends to %s", network.SendURL())
+	}
+}
+
+func TestLedgersOnSeparateNetworks(t *testing.T) {
+	fmt.Println("Running TestLedgersOnSeparateNetworks...")
+
+	ctx := context.Background()
+	first, second := NewSimulator(), NewSimulator()
+	firstLedger, firstServer := newSimulatedLedger(first)
+	defer firstServer.Close()
+	secondLedger, secondServer := newSimulatedLedger(second)
+	defer secondServer.Close()
+
+	first.Mint("Alice", Coin(1000))
+	second.Mint("Alice", Coin(500))
+
+	// each ledger only ever talks to its own deployment
+	firstLedger.SendTransaction(ctx, "Alice", "Bob", Coin(100))
+	secondLedger.SendTransaction(ctx, "Alice", "Bob", Coin(200))
+
+	if first.Balance("Bob") != Coin(100) || second.Balance("Bob") != Coin(200) {
+		t.Errorf("Expected Bob to hold 1.00 and 2.00 on the two networks, saw %v and %v",
+			first.Balance("Bob").ToString(), second.Balance("Bob").ToString())
+	}
+}
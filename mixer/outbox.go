@@ -0,0 +1,211 @@
+package mixer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+type PayoutStatus string
+
+const (
+	PAYOUT_PLANNED   PayoutStatus = "planned"   // recorded, but not known to have been sent
+	PAYOUT_SENT      PayoutStatus = "sent"      // the ledger accepted the send
+	PAYOUT_CONFIRMED PayoutStatus = "confirmed" // the payout was found on the ledger
+)
+
+// PayoutIntent is a single payout a batch has committed to making. It's journaled
+// before anything is sent, so after a crash the batch knows every payout it may have
+// made and can look for it on the ledger instead of guessing
+type PayoutIntent struct {
+	ID          string       `json:"id"`
+	Pool        Address      `json:"pool"`
+	Recipient   Address      `json:"recipient"`
+	Amount      Coin         `json:"amount"`
+	PlannedAt   time.Time    `json:"plannedAt"`
+	ScheduledAt time.Time    `json:"scheduledAt"`
+	Status      PayoutStatus `json:"status"`
+	Transaction string       `json:"transaction,omitempty"` // the ledger transaction that confirmed it
+
+	unsure bool // see Batch.send
+}
+
+// transfer is the transaction on the ledger that confirms intent
+func (intent *PayoutIntent) transfer() transfer {
+	return transfer{intent.ID, intent.Pool, intent.Recipient, intent.Amount, intent.PlannedAt.Add(-CLOCK_SKEW_ALLOWANCE)}
+}
+
+func NewPayoutIntent(batch Address, index int, pool, recipient Address, amount Coin, scheduledAt time.Time) *PayoutIntent {
+	plannedAt := time.Now().UTC()
+	sum := sha256.Sum256([]byte(fmt.Sprintf(
+		"%s|%d|%s|%s|%d|%s", batch, index, pool, recipient, amount, plannedAt.Format(time.RFC3339Nano))))
+
+	return &PayoutIntent{
+		ID:          hex.EncodeToString(sum[:16]),
+		Pool:        pool,
+		Recipient:   recipient,
+		Amount:      amount,
+		PlannedAt:   plannedAt,
+		ScheduledAt: scheduledAt,
+		Status:      PAYOUT_PLANNED,
+	}
+}
+
+// Outbox holds the payouts of a batch. Once planned the intents never change, only
+// their status moves forward, so the same payouts are made however often the batch
+// is interrupted
+type Outbox struct {
+	Intents []*PayoutIntent
+}
+
+func NewOutbox(intents ...*PayoutIntent) *Outbox {
+	return &Outbox{intents}
+}
+
+func (o *Outbox) find(id string) *PayoutIntent {
+	for _, intent := range o.Intents {
+		if intent.ID == id {
+			return intent
+		}
+	}
+	return nil
+}
+
+// Unconfirmed returns the intents that haven't been found on the ledger yet
+func (o *Outbox) Unconfirmed() []*PayoutIntent {
+	var intents []*PayoutIntent
+	for _, intent := range o.Intents {
+		if intent.Status != PAYOUT_CONFIRMED {
+			intents = append(intents, intent)
+		}
+	}
+	return intents
+}
+
+// deliver sends intent unless the ledger shows it was already sent. Only unsure intents
+// need checking, anything else is known not to have been sent
+func (b *Batch) deliver(ctx context.Context, pool *Wallet, intent *PayoutIntent) error {
+	// the intent is paid out of the pool it was planned against, which holds its funds
+	from := NewWallet(pool.ledger, intent.Pool)
+	found, err := b.send(ctx, from, intent.Recipient, intent.Amount, &intent.unsure, func(ctx context.Context) (bool, error) {
+		err := b.reconcile(ctx, pool, []*PayoutIntent{intent})
+		return intent.Status != PAYOUT_PLANNED, err
+	})
+	if err != nil || found {
+		return err
+	}
+	err = b.markSent(intent)
+	if err != nil {
+		return err
+	}
+	b.Claims.Sent(intent.transfer())
+	return nil
+}
+
+func (b *Batch) markSent(intent *PayoutIntent) error {
+	intent.Status = PAYOUT_SENT
+	return b.record(JOURNAL_PAYOUT, JournalEntry{IntentID: intent.ID, Recipient: intent.Recipient, Amount: intent.Amount})
+}
+
+// reconcile looks for intents on the ledger, fetching each recipient's history once.
+// An intent is confirmed by a transaction of the same amount from its pool to its
+// recipient, made after it was planned and not claimed by another intent, see Claims.
+// Intents that were sent to the same recipients are looked for first, since their
+// transactions are certainly on the ledger and a planned intent mustn't take them. A
+// recipient whose history the ledger is too busy to serve is skipped, so the others
+// are still reconciled, and the first such error is returned once they are
+func (b *Batch) reconcile(ctx context.Context, pool *Wallet, intents []*PayoutIntent) (err error) {
+	recipients := map[Address]bool{}
+	for _, intent := range intents {
+		recipients[intent.Recipient] = true
+	}
+	var ordered []*PayoutIntent
+	for _, intent := range b.Outbox.Unconfirmed() {
+		if intent.Status == PAYOUT_SENT && recipients[intent.Recipient] {
+			ordered = append(ordered, intent)
+		}
+	}
+	for _, intent := range intents {
+		if intent.Status == PAYOUT_PLANNED {
+			ordered = append(ordered, intent)
+		}
+	}
+
+	infos := map[Address]*AddressInfo{}
+	for _, intent := range ordered {
+		info, ok := infos[intent.Recipient]
+		if !ok {
+			var getErr error
+			info, getErr = pool.ledger.GetAddressInfo(ctx, intent.Recipient)
+			if getErr != nil && (ctx.Err() != nil || !IsTransient(getErr)) {
+				return getErr
+			}
+			if getErr != nil && err == nil {
+				err = getErr
+			}
+			infos[intent.Recipient] = info
+		}
+		if info == nil {
+			continue
+		}
+
+		matchErr := b.match(intent, info.Transactions)
+		if matchErr != nil {
+			return matchErr
+		}
+	}
+	return err
+}
+
+func (b *Batch) match(intent *PayoutIntent, txns []*Transaction) error {
+	txn := b.Claims.Claim(intent.transfer(), txns)
+	if txn == nil {
+		return nil
+	}
+
+	if intent.Status == PAYOUT_PLANNED {
+		fmt.Printf("Payout %s to '%s' was already sent, not sending it again\n", intent.ID, intent.Recipient)
+		err := b.markSent(intent)
+		if err != nil {
+			return err
+		}
+	}
+	intent.Status = PAYOUT_CONFIRMED
+	intent.Transaction = txn.ID()
+	return b.record(JOURNAL_CONFIRMED, JournalEntry{IntentID: intent.ID, Transaction: txn.ID()})
+}
+
+// confirm waits for every sent payout to show up on the ledger. A payout that still
+// hasn't after a few polls leaves the batch unfinished, to be confirmed when it resumes.
+// Only polls that saw every recipient's history count, one the ledger was too busy
+// for doesn't show that anything is missing
+func (b *Batch) confirm(ctx context.Context, pool *Wallet) error {
+	for attempt := 1; attempt <= MAX_SEND_ATTEMPTS; {
+		unconfirmed := b.Outbox.Unconfirmed()
+		if len(unconfirmed) == 0 {
+			return nil
+		}
+
+		err := b.reconcile(ctx, pool, unconfirmed)
+		if err != nil && (ctx.Err() != nil || !IsTransient(err)) {
+			return err
+		}
+
+		if len(b.Outbox.Unconfirmed()) == 0 {
+			return nil
+		}
+		if err != nil {
+			fmt.Printf("Could not confirm every payout of batch '%s', will retry: %s\n", b.Source.Address, err)
+		} else {
+			attempt++
+		}
+		if sleepErr := sleepContext(ctx, b.PollInterval); sleepErr != nil {
+			return sleepErr
+		}
+	}
+
+	intent := b.Outbox.Unconfirmed()[0]
+	return fmt.Errorf("Payout %s of %v to '%s' hasn't appeared on the ledger", intent.ID, b.format(intent.Amount), intent.Recipient)
+}
@@ -0,0 +1,138 @@
+package mixer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBatchTumbleConfirmsPayouts(t *testing.T) {
+	fmt.Println("Running TestBatchTumbleConfirmsPayouts...")
+
+	ledger := &testLedger{}
+	pool := NewWallet(ledger, "Pool")
+	batch := NewBatch(Coin(1200), Coin(200), pool, NewAddresses(3), 1)
+	batch.PollInterval = 0
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+
+	err := batch.Tumble(pool)
+	if err != nil {
+		t.Fatalf("Batch.Tumble returned unexpected error %s", err)
+	}
+
+	paidOut := Coin(0)
+	claimed := map[string]bool{}
+	for _, intent := range batch.Outbox.Intents {
+		if intent.Status != PAYOUT_CONFIRMED || intent.Transaction == "" || claimed[intent.Transaction] {
+			t.Errorf("Expected payout %v to be confirmed by a transaction of its own", intent)
+		}
+		claimed[intent.Transaction] = true
+		paidOut += intent.Amount
+	}
+	if paidOut != Coin(1000) || len(ledger.txns) != len(batch.Outbox.Intents) {
+		t.Errorf("Expected 10.00 paid out in %d sends, saw %v in %v",
+			len(batch.Outbox.Intents), paidOut.ToString(), ledger.txns)
+	}
+}
+
+// a payout the ledger made but whose response never came back is found on the
+// ledger before it's sent again, and isn't sent a second time
+func TestBatchTumbleLostResponse(t *testing.T) {
+	fmt.Println("Running TestBatchTumbleLostResponse...")
+
+	path, cleanup := tempJournal(t)
+	defer cleanup()
+
+	sim := NewSimulator()
+	_, server := newSimulatedLedger(sim)
+	defer server.Close()
+	faults := NewScriptedFaults(Fault{Kind: FAULT_LOST_RESPONSE})
+	ledger := NewJobcoinLedger(NewFaultyClient(NewApiClient(), faults), LocalNetwork().WithBaseURL(server.URL))
+
+	journal, _ := OpenJournal(path)
+	defer journal.Close()
+
+	amount := Coin(1200)
+	mixer := NewMixer(ledger, nil)
+	mixer.Journal = journal
+	source := NewWallet(ledger, NewAddresses(1)[0])
+	batch, err := mixer.NewBatch(source, NewAmount(amount, DEFAULT_ASSET, DEFAULT_PRECISION), NewDestinations(NewAddresses(3)), 5, HalvingStrategy{})
+	if err != nil {
+		t.Fatalf("Mixer.NewBatch returned unexpected error %s", err)
+	}
+	batch.PollInterval = time.Duration(10) * time.Millisecond
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+
+	pool := NewWallet(ledger, "Pool")
+	sim.Mint(pool.Address, amount)
+	err = batch.Tumble(pool)
+	if err != nil {
+		t.Fatalf("Batch.Tumble returned unexpected error %s", err)
+	}
+	intents := batch.Outbox.Intents
+
+	sends := 0
+	for _, txn := range sim.Transactions() {
+		if txn.Source == pool.Address {
+			sends += 1
+		}
+	}
+	if sends != len(intents) {
+		t.Errorf("Expected exactly %d payouts on the ledger, saw %d", len(intents), sends)
+	}
+	for _, intent := range intents {
+		if sim.Balance(intent.Recipient) != intent.Amount {
+			t.Errorf("Expected '%s' to be paid %v, saw %v",
+				intent.Recipient, intent.Amount.ToString(), sim.Balance(intent.Recipient).ToString())
+		}
+	}
+
+	unfinished, _ := journal.Unfinished()
+	if len(unfinished) != 0 {
+		t.Errorf("Expected the batch to be finished once every payout was confirmed, saw %v", unfinished)
+	}
+}
+
+// flakyLedger can't serve one address's history for its next few lookups
+type flakyLedger struct {
+	*testLedger
+	flaky    Address
+	failures int
+}
+
+func (l *flakyLedger) GetAddressInfo(ctx context.Context, address Address) (*AddressInfo, error) {
+	if address == l.flaky && l.failures > 0 {
+		l.failures -= 1
+		return nil, ErrServerUnavailable
+	}
+	return l.testLedger.GetAddressInfo(ctx, address)
+}
+
+// a recipient the ledger keeps failing to look up doesn't hold up the others, nor
+// use up the polls its payout gets to appear in
+func TestBatchConfirmFlakyLedger(t *testing.T) {
+	fmt.Println("Running TestBatchConfirmFlakyLedger...")
+
+	ledger := &flakyLedger{&testLedger{}, "Bob", MAX_SEND_ATTEMPTS + 1}
+	batch := NewBatch(Coin(1000), Coin(0), NewWallet(ledger, "Tumbler"), []Address{"Bob", "Charles"}, 1)
+	batch.PollInterval = 0
+	for i, recipient := range batch.Recipients {
+		intent := NewPayoutIntent("Tumbler", i, "Pool", recipient, Coin(500), time.Now())
+		ledger.SendTransaction(context.Background(), "Pool", recipient, Coin(500))
+		intent.Status = PAYOUT_SENT
+		batch.Outbox.Intents = append(batch.Outbox.Intents, intent)
+	}
+
+	err := batch.confirm(context.Background(), NewWallet(ledger, "Pool"))
+	if err != nil {
+		t.Fatalf("Batch.confirm returned unexpected error %s", err)
+	}
+	if len(batch.Outbox.Unconfirmed()) != 0 {
+		t.Errorf("Expected both payouts to be confirmed, saw %v", batch.Outbox.Intents)
+	}
+}
@@ -0,0 +1,426 @@
+package mixer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+var ErrInvalidPlan = errors.New("Invalid Payout Plan")
+
+// PayoutPlan is every payout a batch is going to make, worked out in full once its
+// deposits are credited and before any money moves. Remainder is kept in the pool on
+// top of Fee, when payouts are made in Denominations that don't add up to a share
+// exactly. Its amounts are written out with Precision decimal places, the precision
+// of the batch's ledger
+type PayoutPlan struct {
+	Batch         Address         `json:"batch"`
+	Asset         Asset           `json:"asset"`
+	Precision     int             `json:"precision"`
+	Amount        Coin            `json:"amount"`
+	Fee           Coin            `json:"fee"`
+	Denominations *Denominations  `json:"denominations,omitempty"`
+	Remainder     Coin            `json:"remainder,omitempty"`
+	Payouts       []*PayoutIntent `json:"payouts"`
+}
+
+// Validate checks that the plan pays out exactly the batch's amount less its fee, in
+// payouts of more than nothing to addresses it was asked to pay. Only what's smaller
+// than the smallest denomination can be kept back as Remainder, at most once per
+// recipient
+func (p *PayoutPlan) Validate(recipients []Address) error {
+	allowed := map[Address]bool{}
+	for _, recipient := range recipients {
+		allowed[recipient] = true
+	}
+
+	if p.Fee < 0 || p.Remainder < 0 {
+		return fmt.Errorf("%w: fee %v and remainder %v can't be negative",
+			ErrInvalidPlan, p.format(p.Fee), p.format(p.Remainder))
+	}
+
+	most := Coin(0)
+	if p.Denominations != nil && p.Denominations.Remainder == REMAINDER_FEE {
+		smallest := p.Denominations.Values[len(p.Denominations.Values)-1]
+		var err error
+		most, err = (smallest - 1).MulRatio(int64(len(recipients)), 1)
+		if err != nil {
+			return err
+		}
+	}
+	if p.Remainder > most {
+		return fmt.Errorf("%w: remainder %v is more than the %v its denominations can leave over",
+			ErrInvalidPlan, p.format(p.Remainder), p.format(most))
+	}
+	if len(p.Payouts) == 0 && len(recipients) > 0 && p.Amount > p.Fee {
+		return fmt.Errorf("%w: %v is left after the fee but nothing is paid out", ErrInvalidPlan, p.format(p.Amount-p.Fee))
+	}
+
+	total, err := p.Fee.Add(p.Remainder)
+	if err != nil {
+		return err
+	}
+	for i, payout := range p.Payouts {
+		if payout.Amount <= 0 {
+			return fmt.Errorf("%w: payout %d to '%s' is %v", ErrInvalidPlan, i, payout.Recipient, p.format(payout.Amount))
+		}
+		if !allowed[payout.Recipient] {
+			return fmt.Errorf("%w: payout %d is to '%s', which isn't a recipient of the batch", ErrInvalidPlan, i, payout.Recipient)
+		}
+		if payout.Pool == "" {
+			return fmt.Errorf("%w: payout %d to '%s' has no pool to pay it", ErrInvalidPlan, i, payout.Recipient)
+		}
+
+		total, err = total.Add(payout.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	if total != p.Amount {
+		return fmt.Errorf("%w: payouts, fee and remainder add up to %v, but the batch is %v",
+			ErrInvalidPlan, p.format(total), p.format(p.Amount))
+	}
+	return nil
+}
+
+func (p *PayoutPlan) format(amount Coin) string {
+	return amount.Format(p.Precision)
+}
+
+// the JSON forms of a plan, its intents and its denominations, with amounts written at
+// the plan's Precision instead of DEFAULT_PRECISION
+type (
+	planJSON struct {
+		*planFields
+		Amount        string              `json:"amount"`
+		Fee           string              `json:"fee"`
+		Denominations *denominationsJSON  `json:"denominations,omitempty"`
+		Remainder     string              `json:"remainder,omitempty"`
+		Payouts       []*payoutIntentJSON `json:"payouts"`
+	}
+	planFields       PayoutPlan
+	payoutIntentJSON struct {
+		*PayoutIntent
+		Amount string `json:"amount"`
+	}
+	denominationsJSON struct {
+		*Denominations
+		Values []string `json:"values"`
+	}
+)
+
+func (p *PayoutPlan) MarshalJSON() ([]byte, error) {
+	v := planJSON{planFields: (*planFields)(p), Amount: p.format(p.Amount), Fee: p.format(p.Fee)}
+	if p.Remainder != 0 {
+		v.Remainder = p.format(p.Remainder)
+	}
+	if p.Denominations != nil {
+		v.Denominations = &denominationsJSON{Denominations: p.Denominations}
+		for _, value := range p.Denominations.Values {
+			v.Denominations.Values = append(v.Denominations.Values, p.format(value))
+		}
+	}
+	v.Payouts = []*payoutIntentJSON{}
+	for _, intent := range p.Payouts {
+		v.Payouts = append(v.Payouts, &payoutIntentJSON{intent, p.format(intent.Amount)})
+	}
+	return json.Marshal(v)
+}
+
+func (p *PayoutPlan) UnmarshalJSON(b []byte) error {
+	v := planJSON{planFields: (*planFields)(p)}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	// the precision has to be read before any of the amounts can be
+	parse := func(amount string) Coin {
+		if err != nil || amount == "" {
+			return 0
+		}
+		var c Coin
+		c, err = ParseCoin(amount, p.Precision)
+		return c
+	}
+	p.Amount, p.Fee, p.Remainder = parse(v.Amount), parse(v.Fee), parse(v.Remainder)
+	// an object that only has the keys the views shadow leaves the embedded struct nil
+	p.Denominations = nil
+	if v.Denominations != nil {
+		p.Denominations = v.Denominations.Denominations
+		if p.Denominations == nil {
+			p.Denominations = &Denominations{}
+		}
+		p.Denominations.Values = nil
+		for _, value := range v.Denominations.Values {
+			p.Denominations.Values = append(p.Denominations.Values, parse(value))
+		}
+	}
+	p.Payouts = nil
+	for i, intent := range v.Payouts {
+		if intent == nil {
+			return fmt.Errorf("Payout %d of the plan is null", i)
+		}
+		if intent.PayoutIntent == nil {
+			intent.PayoutIntent = &PayoutIntent{}
+		}
+		intent.PayoutIntent.Amount = parse(intent.Amount)
+		p.Payouts = append(p.Payouts, intent.PayoutIntent)
+	}
+	return err
+}
+
+func (p *PayoutPlan) String() string {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%s: %s", p.Batch, err)
+	}
+	return string(b)
+}
+
+// Plan returns b's PayoutPlan, working it out the first time it's called. What's left
+// of the batch after its fee is split between its recipients, each
+// payout scheduled a random delay after the last, and the whole plan is journaled
+// before it's returned
+func (b *Batch) Plan(pool *Wallet) (*PayoutPlan, error) {
+	plan := &PayoutPlan{b.Source.Address, b.Asset, PrecisionOf(b.Source.ledger), b.Amount, b.Fee, b.Denominations, Coin(0), b.Outbox.Intents}
+
+	if len(b.Outbox.Intents) > 0 {
+		// the remainder isn't journaled, it's whatever the intents don't pay out
+		if b.Denominations != nil && b.Denominations.Remainder == REMAINDER_FEE {
+			var err error
+			plan.Remainder, err = plan.unplanned()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return plan, plan.Validate(b.Recipients)
+	}
+
+	amount, err := b.Amount.Sub(b.Fee) //keep b.Fee amount in the pool
+	if err != nil {
+		return nil, err
+	}
+	if amount < 0 || b.Fee < 0 {
+		return nil, fmt.Errorf("Fee %v doesn't fit in batch amount %v", b.format(b.Fee), b.format(b.Amount))
+	}
+
+	var shares []Coin
+	if amount > 0 && len(b.Recipients) > 0 {
+		shares, err = b.shares(amount, b.Recipients)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	payouts, err := b.denominate(plan, b.Recipients, shares)
+	if err != nil {
+		return nil, err
+	}
+
+	// the payouts come out of the pool that holds the deposits, which isn't pool if the
+	// batch was resumed after the pool moved on
+	from := pool.Address
+	if b.Pool != "" {
+		from = b.Pool
+	}
+
+	scheduledAt := time.Now().UTC()
+	for i, payout := range payouts {
+		delay := time.Duration(b.DelayGenerator(10))
+		scheduledAt = scheduledAt.Add(delay * time.Second)
+		plan.Payouts = append(plan.Payouts, NewPayoutIntent(b.Source.Address, i, from, payout.recipient, payout.amount, scheduledAt))
+	}
+
+	err = plan.Validate(b.Recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, intent := range plan.Payouts {
+		err = b.record(JOURNAL_INTENT, JournalEntry{Intent: intent})
+		if err != nil {
+			return nil, err
+		}
+	}
+	b.Outbox.Intents = plan.Payouts
+	return plan, nil
+}
+
+// checkPayouts makes sure b can be split between its recipients the way Plan will
+// split it, which catches a MinimumStrategy whose minimum doesn't fit, and paid out
+// in its Denominations
+func (b *Batch) checkPayouts() error {
+	amount, err := b.Amount.Sub(b.Fee)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 || len(b.Recipients) == 0 {
+		return nil
+	}
+
+	_, err = b.shares(amount, b.Recipients)
+	if err != nil || b.Denominations == nil {
+		return err
+	}
+	return b.checkDenominations(amount)
+}
+
+type payout struct {
+	recipient Address
+	amount    Coin
+}
+
+// denominate turns each recipient's share into the payouts that make it up. Without
+// Denominations that's the share itself. With them it's a payout per denomination,
+// shuffled with everyone else's so nobody's payouts are sent one after the other,
+// and the remainder is either added to plan.Remainder or paid out as change. A fixed
+// amount is always paid in full, so its remainder is paid out as change regardless
+func (b *Batch) denominate(plan *PayoutPlan, recipients []Address, shares []Coin) ([]payout, error) {
+	fixed := map[Address]bool{}
+	for _, destination := range b.Destinations {
+		fixed[destination.Address] = destination.Amount > 0
+	}
+
+	var payouts []payout
+	for i, share := range shares {
+		// strategies leave out recipients that get nothing
+		if share == 0 {
+			continue
+		}
+		if b.Denominations == nil {
+			payouts = append(payouts, payout{recipients[i], share})
+			continue
+		}
+
+		amounts, remainder, err := b.Denominations.Split(share)
+		if err != nil {
+			return nil, fmt.Errorf("Can't pay %v to '%s': %s", b.format(share), recipients[i], err)
+		}
+		for _, amount := range amounts {
+			payouts = append(payouts, payout{recipients[i], amount})
+		}
+
+		if remainder == 0 {
+			continue
+		}
+		if b.Denominations.Remainder == REMAINDER_CHANGE || fixed[recipients[i]] {
+			payouts = append(payouts, payout{recipients[i], remainder})
+			continue
+		}
+		plan.Remainder, err = plan.Remainder.Add(remainder)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if b.Denominations != nil {
+		rand.Shuffle(len(payouts), func(i, j int) { payouts[i], payouts[j] = payouts[j], payouts[i] })
+	}
+	return payouts, nil
+}
+
+// unplanned is what p's fee and payouts leave of the batch amount
+func (p *PayoutPlan) unplanned() (Coin, error) {
+	left, err := p.Amount.Sub(p.Fee)
+	for _, payout := range p.Payouts {
+		if err != nil {
+			break
+		}
+		left, err = left.Sub(payout.Amount)
+	}
+	return left, err
+}
+
+// expire ends a batch whose deposits didn't add up to its amount before it timed out.
+// It's journaled as expired first, so it's never resumed to wait for deposits again.
+// Whatever was deposited is refunded in full, no fee taken, to the address it came
+// from: the batch can't be mixed, and keeping part of it would strand the rest in the
+// pool. Refunds are intents like any payout, so they're made exactly once and the batch
+// only finishes once they're confirmed
+func (b *Batch) expire(ctx context.Context, pool *Wallet) error {
+	if !b.Expired {
+		fmt.Printf("Batch for address '%s' expired with %v of %v deposited\n",
+			b.Source.Address, b.format(b.Credited), b.format(b.Amount))
+		b.Expired = true
+		err := b.record(JOURNAL_EXPIRED, JournalEntry{})
+		if err != nil {
+			return err
+		}
+	}
+
+	// a deposit that's still on its way has to reach the pool before it's refunded, so
+	// forwards the ledger was too busy for are retried until they get there
+	pending := b.pendingForwards()
+	for len(pending) > 0 {
+		var credited Coin
+		var err error
+		credited, pending, err = b.credit(ctx, pool, pending)
+		if err != nil {
+			return err
+		}
+		b.Credited, err = b.Credited.Add(credited)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			err = sleepContext(ctx, b.PollInterval)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(b.Outbox.Intents) == 0 {
+		now := time.Now().UTC()
+		for i, f := range b.Forwards {
+			// journaled before deposits without a source were rejected
+			if f.Depositor == "" {
+				fmt.Printf("Deposit %s has no source to refund it to, keeping it in the pool\n", f.Deposit)
+				continue
+			}
+			intent := NewPayoutIntent(b.Source.Address, i, f.Pool, f.Depositor, f.Amount, now)
+			err := b.record(JOURNAL_INTENT, JournalEntry{Intent: intent})
+			if err != nil {
+				return err
+			}
+			b.Outbox.Intents = append(b.Outbox.Intents, intent)
+		}
+	}
+	return b.Execute(ctx, pool)
+}
+
+// Execute makes the payouts in b's plan that haven't been made yet, each at the time it
+// was scheduled for, and waits for all of them to be confirmed on the ledger. It stops
+// before the next payout once ctx is cancelled
+func (b *Batch) Execute(ctx context.Context, pool *Wallet) (err error) {
+	for _, intent := range b.Outbox.Intents {
+		if intent.Status != PAYOUT_PLANNED {
+			continue
+		}
+
+		// a payout that's overdue, after a resume, mustn't race cancellation
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = sleepContext(ctx, time.Until(intent.ScheduledAt))
+		if err != nil {
+			return err
+		}
+
+		err = b.deliver(ctx, pool, intent)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = b.confirm(ctx, pool)
+	if err != nil {
+		return err
+	}
+	return b.record(JOURNAL_DONE, JournalEntry{})
+}
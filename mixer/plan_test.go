@@ -0,0 +1,146 @@
+package mixer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBatchPlan(t *testing.T) {
+	fmt.Println("Running TestBatchPlan...")
+
+	ledger := &testLedger{}
+	recipients := NewAddresses(4)
+	batch := NewBatch(Coin(1200), Coin(200), NewWallet(ledger, "Tumbler"), recipients, 1)
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 2
+	}
+
+	start := time.Now()
+	plan, err := batch.Plan(NewWallet(ledger, "Pool"))
+	if err != nil {
+		t.Fatalf("Batch.Plan returned unexpected error %s", err)
+	}
+	if err = plan.Validate(recipients); err != nil {
+		t.Errorf("Expected the plan to be valid, saw '%s'", err)
+	}
+	if len(ledger.txns) != 0 {
+		t.Errorf("Expected planning not to move any money, saw %v", ledger.txns)
+	}
+
+	previous := start
+	for i, payout := range plan.Payouts {
+		if payout.Pool != "Pool" || payout.Recipient != recipients[i] || payout.Status != PAYOUT_PLANNED {
+			t.Errorf("Unexpected payout %d in plan: %v", i, payout)
+		}
+		if payout.ScheduledAt.Sub(previous) < time.Duration(2)*time.Second {
+			t.Errorf("Expected payout %d to be scheduled 2s after the one before it, saw %s", i, payout.ScheduledAt)
+		}
+		previous = payout.ScheduledAt
+	}
+
+	// planning again returns the same plan instead of a new one
+	again, _ := batch.Plan(NewWallet(ledger, "Pool"))
+	if len(again.Payouts) != len(plan.Payouts) || again.Payouts[0].ID != plan.Payouts[0].ID {
+		t.Errorf("Expected the batch to keep its plan, saw %v and then %v", plan, again)
+	}
+
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("Could not marshal plan: %s", err)
+	}
+	var decoded PayoutPlan
+	err = json.Unmarshal(b, &decoded)
+	if err != nil || decoded.Validate(recipients) != nil || len(decoded.Payouts) != len(plan.Payouts) {
+		t.Errorf("Expected the plan to survive a JSON round trip, saw %s and error %v", b, err)
+	}
+}
+
+func TestPayoutPlanValidate(t *testing.T) {
+	fmt.Println("Running TestPayoutPlanValidate...")
+
+	recipients := []Address{"Bob", "Charles"}
+	payout := func(recipient Address, amount Coin) *PayoutIntent {
+		return NewPayoutIntent("Tumbler", 0, "Pool", recipient, amount, time.Now())
+	}
+
+	hundreds, _ := NewDenominations([]Coin{Coin(100)}, REMAINDER_FEE)
+	thousands, _ := NewDenominations([]Coin{Coin(1000)}, REMAINDER_FEE)
+
+	cases := []struct {
+		plan  *PayoutPlan
+		valid bool
+	}{
+		{&PayoutPlan{"Tumbler", DEFAULT_ASSET, 2, Coin(1000), Coin(200), nil, Coin(0), []*PayoutIntent{payout("Bob", 300), payout("Charles", 500)}}, true},
+		{&PayoutPlan{"Tumbler", DEFAULT_ASSET, 2, Coin(1000), Coin(200), nil, Coin(0), []*PayoutIntent{payout("Bob", 300), payout("Charles", 400)}}, false},
+		{&PayoutPlan{"Tumbler", DEFAULT_ASSET, 2, Coin(1000), Coin(200), nil, Coin(0), []*PayoutIntent{payout("Bob", 900), payout("Charles", -100)}}, false},
+		{&PayoutPlan{"Tumbler", DEFAULT_ASSET, 2, Coin(1000), Coin(200), nil, Coin(0), []*PayoutIntent{payout("Bob", 800), payout("Charles", 0)}}, false},
+		{&PayoutPlan{"Tumbler", DEFAULT_ASSET, 2, Coin(1000), Coin(200), nil, Coin(0), []*PayoutIntent{payout("Bob", 300), payout("Mallory", 500)}}, false},
+		{&PayoutPlan{"Tumbler", DEFAULT_ASSET, 2, Coin(1000), Coin(200), hundreds, Coin(100), []*PayoutIntent{payout("Bob", 300), payout("Charles", 400)}}, true},
+		{&PayoutPlan{"Tumbler", DEFAULT_ASSET, 2, Coin(1000), Coin(200), nil, Coin(100), []*PayoutIntent{payout("Bob", 300), payout("Charles", 400)}}, false},
+		{&PayoutPlan{"Tumbler", DEFAULT_ASSET, 2, Coin(1000), Coin(200), hundreds, Coin(200), []*PayoutIntent{payout("Bob", 300), payout("Charles", 300)}}, false},
+		{&PayoutPlan{"Tumbler", DEFAULT_ASSET, 2, Coin(1000), Coin(200), thousands, Coin(800), nil}, false},
+	}
+
+	for i, c := range cases {
+		err := c.plan.Validate(recipients)
+		if c.valid && err != nil {
+			t.Errorf("Expected plan %d to be valid, saw '%s'", i, err)
+		}
+		if !c.valid && !errors.Is(err, ErrInvalidPlan) {
+			t.Errorf("Expected plan %d to be rejected with ErrInvalidPlan, saw '%v'", i, err)
+		}
+	}
+}
+
+func TestPayoutPlanPrecision(t *testing.T) {
+	fmt.Println("Running TestPayoutPlanPrecision...")
+
+	denominations, _ := NewDenominations([]Coin{Coin(100000000)}, REMAINDER_FEE)
+	intent := NewPayoutIntent("Tumbler", 0, "Pool", "Bob", Coin(300000000), time.Now())
+	plan := &PayoutPlan{"Tumbler", "SAT", 8, Coin(312345678), Coin(12345678), denominations, 0, []*PayoutIntent{intent}}
+
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("Could not marshal plan: %s", err)
+	}
+	var fields struct {
+		Amount        string
+		Denominations struct{ Values []string }
+		Payouts       []struct{ Amount string }
+	}
+	json.Unmarshal(b, &fields)
+	if fields.Amount != "3.12345678" || fields.Denominations.Values[0] != "1.00000000" || fields.Payouts[0].Amount != "3.00000000" {
+		t.Errorf("Expected amounts to be written with 8 decimal places, saw %s", b)
+	}
+
+	var decoded PayoutPlan
+	err = json.Unmarshal(b, &decoded)
+	if err != nil || decoded.Amount != plan.Amount || decoded.Fee != plan.Fee || decoded.Payouts[0].Amount != intent.Amount ||
+		decoded.Denominations.Values[0] != Coin(100000000) || decoded.Payouts[0].ID != intent.ID {
+		t.Errorf("Expected the plan to survive a JSON round trip at a precision of 8, saw %s and error %v", b, err)
+	}
+	// objects with nothing but the amounts decode to otherwise empty values
+	decoded = PayoutPlan{}
+	err = json.Unmarshal([]byte(`{"precision":2,"payouts":[{"amount":"1.00"}]}`), &decoded)
+	if err != nil || len(decoded.Payouts) != 1 || decoded.Payouts[0].Amount != Coin(100) {
+		t.Errorf("Expected a payout with only an amount to decode, saw %v and error %v", decoded.Payouts, err)
+	}
+	decoded = PayoutPlan{}
+	err = json.Unmarshal([]byte(`{"precision":2,"denominations":{"values":["1.00"]}}`), &decoded)
+	if err != nil || decoded.Denominations == nil || len(decoded.Denominations.Values) != 1 {
+		t.Errorf("Expected denominations with only values to decode, saw %v and error %v", decoded.Denominations, err)
+	}
+	// without a precision there are no decimal places to read them at
+	decoded = PayoutPlan{}
+	err = json.Unmarshal([]byte(`{"denominations":{"values":["1.00"]}}`), &decoded)
+	if err == nil {
+		t.Errorf("Expected amounts with more decimal places than the plan's precision to be rejected")
+	}
+	err = json.Unmarshal([]byte(`{"payouts":[null]}`), &decoded)
+	if err == nil {
+		t.Errorf("Expected a null payout to be rejected")
+	}
+}
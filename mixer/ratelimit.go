@@ -0,0 +1,159 @@
+package mixer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type RequestKind int
+
+const (
+	READ_REQUEST RequestKind = iota
+	SEND_REQUEST
+)
+
+const (
+	READS_PER_SECOND = 10
+	READ_BURST       = 20
+	SENDS_PER_SECOND = 5
+	SEND_BURST       = 10
+)
+
+type tokenBucket struct {
+	rate   float64 // tokens added per second
+	burst  float64 // most tokens the bucket can hold
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate, burst, burst, time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// how long until the bucket holds a whole token
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// RequestBudget is a snapshot of a RateLimiter: how many requests of each kind it has
+// let through so far, and how many more it would let through right now
+type RequestBudget struct {
+	ReadsUsed      int
+	SendsUsed      int
+	ReadsAvailable int
+	SendsAvailable int
+}
+
+// RateLimiter keeps the requests made to a ledger within separate token bucket budgets
+// for reads and sends. Sends are payouts and deposit forwards, which are what users
+// are waiting on, so reads hold off for as long as any send is waiting for a token
+type RateLimiter struct {
+	mutex        sync.Mutex
+	reads        *tokenBucket
+	sends        *tokenBucket
+	waitingSends int
+	readsUsed    int
+	sendsUsed    int
+}
+
+func NewRateLimiter(readsPerSecond, readBurst, sendsPerSecond, sendBurst float64) *RateLimiter {
+	return &RateLimiter{
+		reads: newTokenBucket(readsPerSecond, readBurst),
+		sends: newTokenBucket(sendsPerSecond, sendBurst),
+	}
+}
+
+// SharedRateLimiter is used by every ApiClient created with NewApiClient, so all the
+// batches in a process draw from the same budget
+var SharedRateLimiter = NewRateLimiter(READS_PER_SECOND, READ_BURST, SENDS_PER_SECOND, SEND_BURST)
+
+// Wait blocks until a request of the given kind fits in the budget, or ctx is cancelled
+func (l *RateLimiter) Wait(ctx context.Context, kind RequestKind) error {
+	queued := false
+	defer func() {
+		if queued {
+			l.mutex.Lock()
+			l.waitingSends -= 1
+			l.mutex.Unlock()
+		}
+	}()
+
+	for {
+		delay, ok := l.reserve(kind, &queued)
+		if ok {
+			return nil
+		}
+
+		err := sleepContext(ctx, delay)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reserve takes a token if one is available, otherwise it returns how long to wait
+// before trying again
+func (l *RateLimiter) reserve(kind RequestKind, queued *bool) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.reads.refill(now)
+	l.sends.refill(now)
+
+	if kind == SEND_REQUEST {
+		if l.sends.tokens >= 1 {
+			l.sends.tokens -= 1
+			l.sendsUsed += 1
+			return 0, true
+		}
+		if !*queued {
+			*queued = true
+			l.waitingSends += 1
+		}
+		return l.sends.wait(), false
+	}
+
+	if l.waitingSends == 0 && l.reads.tokens >= 1 {
+		l.reads.tokens -= 1
+		l.readsUsed += 1
+		return 0, true
+	}
+	// while sends are queued, check back once they've had a chance to go out
+	delay := l.reads.wait()
+	if sendDelay := l.sends.wait(); sendDelay > delay {
+		delay = sendDelay
+	}
+	if delay == 0 {
+		delay = time.Millisecond
+	}
+	return delay, false
+}
+
+func (l *RateLimiter) Budget() RequestBudget {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.reads.refill(now)
+	l.sends.refill(now)
+
+	return RequestBudget{
+		l.readsUsed,
+		l.sendsUsed,
+		int(l.reads.tokens),
+		int(l.sends.tokens),
+	}
+}
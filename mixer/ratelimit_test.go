@@ -0,0 +1,95 @@
+package mixer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBudget(t *testing.T) {
+	fmt.Println("Running TestRateLimiterBudget...")
+
+	ctx := context.Background()
+	limiter := NewRateLimiter(20, 2, 20, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.Wait(ctx, READ_REQUEST)
+	}
+	limiter.Wait(ctx, SEND_REQUEST)
+
+	// the burst covers the first two reads, the third has to wait for a token at 20/s
+	elapsed := time.Since(start)
+	if elapsed < time.Duration(40)*time.Millisecond {
+		t.Errorf("Expected the third read to be throttled, but 3 reads took %s", elapsed)
+	}
+
+	budget := limiter.Budget()
+	if budget.ReadsUsed != 3 || budget.SendsUsed != 1 || budget.SendsAvailable != 0 {
+		t.Errorf("Unexpected request budget %+v", budget)
+	}
+}
+
+func TestRateLimiterPrioritizesSends(t *testing.T) {
+	fmt.Println("Running TestRateLimiterPrioritizesSends...")
+
+	ctx := context.Background()
+	limiter := NewRateLimiter(100, 10, 10, 1)
+	limiter.Wait(ctx, SEND_REQUEST)
+
+	order := make(chan RequestKind, 2)
+	go func() {
+		limiter.Wait(ctx, SEND_REQUEST)
+		order <- SEND_REQUEST
+	}()
+
+	// give the send time to queue up, then ask for a read that has tokens available
+	time.Sleep(time.Duration(10) * time.Millisecond)
+	go func() {
+		limiter.Wait(ctx, READ_REQUEST)
+		order <- READ_REQUEST
+	}()
+
+	if first := <-order; first != SEND_REQUEST {
+		t.Errorf("Expected the queued send to go out before the read")
+	}
+	<-order
+}
+
+func TestRateLimiterContextCancel(t *testing.T) {
+	fmt.Println("Running TestRateLimiterContextCancel...")
+
+	limiter := NewRateLimiter(0.001, 1, 0.001, 1)
+	limiter.Wait(context.Background(), READ_REQUEST)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(20)*time.Millisecond)
+	defer cancel()
+
+	err := limiter.Wait(ctx, READ_REQUEST)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected RateLimiter.Wait to give up at the deadline, saw '%v'", err)
+	}
+}
+
+func TestApiClientUsesRateLimiter(t *testing.T) {
+	fmt.Println("Running TestApiClientUsesRateLimiter...")
+
+	tServer := httptest.NewServer(http.HandlerFunc(mockHandler(HTTP_OK, []string{})))
+	defer tServer.Close()
+
+	apiClient := newTestApiClient()
+	apiClient.Limiter = NewRateLimiter(READS_PER_SECOND, READ_BURST, SENDS_PER_SECOND, SEND_BURST)
+
+	apiClient.JSONGetRequest(tServer.URL)
+	apiClient.JSONGetRequest(tServer.URL)
+	apiClient.JSONPostRequest(tServer.URL, bytes.NewBufferString(`{}`))
+
+	budget := apiClient.Limiter.Budget()
+	if budget.ReadsUsed != 2 || budget.SendsUsed != 1 {
+		t.Errorf("Expected 2 reads and 1 send to be counted, saw %+v", budget)
+	}
+}
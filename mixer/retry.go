@@ -0,0 +1,171 @@
+package mixer
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	REQUEST_TIMEOUT   = time.Duration(10) * time.Second
+	BREAKER_THRESHOLD = 5
+	BREAKER_COOLDOWN  = time.Duration(30) * time.Second
+)
+
+// ErrCircuitOpen is returned without contacting the ledger while the CircuitBreaker
+// considers it unhealthy
+var ErrCircuitOpen = errors.New("Circuit Open")
+
+// RetryPolicy controls how often ApiClient retries a request and how long it waits
+// in between. Delays grow exponentially from BaseDelay up to MaxDelay, and each one is
+// picked at random below that bound so clients that failed together don't retry together
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		3,
+		time.Duration(100) * time.Millisecond,
+		time.Duration(2) * time.Second,
+	}
+}
+
+// Backoff returns how long to wait before retry number attempt (starting at 1)
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	bound := p.BaseDelay
+	for i := 1; i < attempt && bound < p.MaxDelay; i++ {
+		bound *= 2
+	}
+	if bound > p.MaxDelay {
+		bound = p.MaxDelay
+	}
+	if bound <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(bound)) + 1)
+}
+
+// GETs are idempotent, so any transient ledger error or network failure is retried
+func retryableGet(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	var netErr net.Error
+	return IsTransient(err) || errors.As(err, &netErr)
+}
+
+// sends are not idempotent. A send is only retried when we know the ledger never acted
+// on it: it was throttled, or we couldn't even open a connection. Timeouts, resets and
+// 5xx responses may come after the ledger already moved the coins, so they aren't retried
+func retryableSend(err error) bool {
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker stops requests to the ledger after Threshold consecutive failures.
+// Once Cooldown has passed a single request is let through as a probe: if it succeeds
+// the breaker closes again, otherwise it stays open for another Cooldown
+type CircuitBreaker struct {
+	mutex     sync.Mutex
+	Threshold int
+	Cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+}
+
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		Threshold: BREAKER_THRESHOLD,
+		Cooldown:  BREAKER_COOLDOWN,
+	}
+}
+
+// Allow returns ErrCircuitOpen if a request shouldn't be sent right now
+func (c *CircuitBreaker) Allow() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch c.state {
+	case breakerOpen:
+		if time.Since(c.openedAt) < c.Cooldown {
+			return ErrCircuitOpen
+		}
+		c.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		// a probe is already in flight
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// Record reports the outcome of a request that Allow let through. Only failures that
+// say something about the ledger's health count towards opening the breaker
+func (c *CircuitBreaker) Record(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var netErr net.Error
+	unhealthy := errors.Is(err, ErrServerUnavailable) || errors.As(err, &netErr)
+
+	if !unhealthy {
+		c.state = breakerClosed
+		c.failures = 0
+		return
+	}
+
+	c.failures += 1
+	if c.state == breakerHalfOpen || c.failures >= c.Threshold {
+		c.state = breakerOpen
+		c.openedAt = time.Now()
+	}
+}
+
+// Abandon is called instead of Record when a request was cancelled by its caller,
+// which says nothing about the ledger. A cancelled probe frees the way for the next one
+func (c *CircuitBreaker) Abandon() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.state == breakerHalfOpen {
+		c.state = breakerOpen
+	}
+}
+
+func (c *CircuitBreaker) Healthy() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.state == breakerClosed
+}
+
+// sleepContext waits for d, returning early with ctx's error if it's cancelled first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
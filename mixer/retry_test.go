@@ -0,0 +1,192 @@
+package mixer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyHandler responds with each status in statuses in turn, then with 200 forever
+func flakyHandler(statuses ...int) (http.HandlerFunc, func() int) {
+	var mutex sync.Mutex
+	calls := 0
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		calls += 1
+		if calls <= len(statuses) {
+			w.WriteHeader(statuses[calls-1])
+			return
+		}
+		w.Write([]byte(`[]`))
+	}
+	count := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return calls
+	}
+	return handler, count
+}
+
+func newTestApiClient() *ApiClient {
+	apiClient := NewApiClient()
+	apiClient.Retry = &RetryPolicy{3, time.Millisecond, time.Duration(5) * time.Millisecond}
+	apiClient.Limiter = nil
+	return apiClient
+}
+
+func TestApiClientRetriesGetRequests(t *testing.T) {
+	fmt.Println("Running TestApiClientRetriesGetRequests...")
+
+	handler, calls := flakyHandler(HTTP_UNAVAILABLE, http.StatusTooManyRequests)
+	tServer := httptest.NewServer(handler)
+	defer tServer.Close()
+
+	b, err := newTestApiClient().JSONGetRequest(tServer.URL)
+	if err != nil {
+		t.Errorf("ApiClient.JSONGetRequest returned unexpected error %s", err)
+	}
+	if string(b) != `[]` || calls() != 3 {
+		t.Errorf("Expected the third attempt to succeed, saw %d attempts returning '%s'", calls(), b)
+	}
+}
+
+func TestApiClientRetriesSendsCarefully(t *testing.T) {
+	fmt.Println("Running TestApiClientRetriesSendsCarefully...")
+
+	cases := []struct {
+		status   int
+		attempts int
+		success  bool
+	}{
+		// throttled sends were never processed, so they're safe to retry
+		{http.StatusTooManyRequests, 2, true},
+		// the ledger may have moved the coins before failing, so these aren't retried
+		{HTTP_UNAVAILABLE, 1, false},
+		{http.StatusInternalServerError, 1, false},
+	}
+
+	for _, c := range cases {
+		handler, calls := flakyHandler(c.status)
+		tServer := httptest.NewServer(handler)
+
+		err := newTestApiClient().JSONPostRequest(tServer.URL, bytes.NewBufferString(`{"foo":"bar"}`))
+		tServer.Close()
+
+		if (err == nil) != c.success || calls() != c.attempts {
+			t.Errorf("Send answered with status %d: expected %d attempts and success %v, saw %d attempts and error '%v'",
+				c.status, c.attempts, c.success, calls(), err)
+		}
+	}
+
+	// nothing ever reached the ledger if the connection was refused
+	tServer := httptest.NewServer(http.HandlerFunc(mockHandler(HTTP_OK, nil)))
+	url := tServer.URL
+	tServer.Close()
+
+	err := newTestApiClient().JSONPostRequest(url, bytes.NewBufferString(`{"foo":"bar"}`))
+	if err == nil || !retryableSend(err) {
+		t.Errorf("Expected a refused connection to be a retryable send error, saw '%v'", err)
+	}
+}
+
+func TestApiClientTimeout(t *testing.T) {
+	fmt.Println("Running TestApiClientTimeout...")
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(200) * time.Millisecond)
+	}
+	tServer := httptest.NewServer(http.HandlerFunc(handler))
+	defer tServer.Close()
+
+	apiClient := newTestApiClient()
+	apiClient.Retry = nil
+	apiClient.Timeout = time.Duration(20) * time.Millisecond
+
+	_, err := apiClient.JSONGetRequest(tServer.URL)
+	if err == nil {
+		t.Errorf("ApiClient.JSONGetRequest did not time out")
+	}
+}
+
+func TestApiClientContextCancel(t *testing.T) {
+	fmt.Println("Running TestApiClientContextCancel...")
+
+	handler, calls := flakyHandler(HTTP_UNAVAILABLE, HTTP_UNAVAILABLE)
+	tServer := httptest.NewServer(handler)
+	defer tServer.Close()
+
+	apiClient := newTestApiClient()
+	apiClient.Retry = &RetryPolicy{3, time.Hour, time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(50)*time.Millisecond)
+	defer cancel()
+
+	// the first attempt fails and the retry would wait an hour, but the deadline comes first
+	_, err := apiClient.JSONGetRequestContext(ctx, tServer.URL)
+	if !errors.Is(err, context.DeadlineExceeded) || calls() != 1 {
+		t.Errorf("Expected context.DeadlineExceeded after 1 attempt, saw '%v' after %d attempts", err, calls())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	fmt.Println("Running TestCircuitBreaker...")
+
+	handler, calls := flakyHandler(HTTP_UNAVAILABLE, HTTP_UNAVAILABLE, HTTP_UNAVAILABLE)
+	tServer := httptest.NewServer(handler)
+	defer tServer.Close()
+
+	apiClient := newTestApiClient()
+	apiClient.Retry = nil
+	apiClient.Breaker = &CircuitBreaker{Threshold: 2, Cooldown: time.Duration(50) * time.Millisecond}
+
+	apiClient.JSONGetRequest(tServer.URL)
+	apiClient.JSONGetRequest(tServer.URL)
+	if apiClient.Breaker.Healthy() {
+		t.Errorf("Expected the breaker to open after 2 consecutive failures")
+	}
+
+	// while open, requests fail fast without reaching the ledger
+	_, err := apiClient.JSONGetRequest(tServer.URL)
+	if !errors.Is(err, ErrCircuitOpen) || calls() != 2 {
+		t.Errorf("Expected ErrCircuitOpen without a request, saw '%v' after %d requests", err, calls())
+	}
+
+	// after the cooldown a single probe goes through, and a failed probe reopens the breaker
+	time.Sleep(time.Duration(60) * time.Millisecond)
+	_, err = apiClient.JSONGetRequest(tServer.URL)
+	if !errors.Is(err, ErrServerUnavailable) || apiClient.Breaker.Healthy() {
+		t.Errorf("Expected the failed probe to reopen the breaker, saw '%v'", err)
+	}
+
+	time.Sleep(time.Duration(60) * time.Millisecond)
+	_, err = apiClient.JSONGetRequest(tServer.URL)
+	if err != nil || !apiClient.Breaker.Healthy() {
+		t.Errorf("Expected a successful probe to close the breaker, saw '%v'", err)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	fmt.Println("Running TestRetryPolicyBackoff...")
+
+	policy := &RetryPolicy{5, time.Duration(10) * time.Millisecond, time.Duration(50) * time.Millisecond}
+	bounds := []time.Duration{10, 20, 40, 50, 50}
+
+	for i, bound := range bounds {
+		for j := 0; j < 100; j++ {
+			delay := policy.Backoff(i + 1)
+			if delay <= 0 || delay > bound*time.Millisecond {
+				t.Errorf("Backoff(%d) returned %s, expected a delay in (0, %dms]", i+1, delay, bound)
+				break
+			}
+		}
+	}
+}
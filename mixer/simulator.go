@@ -0,0 +1,236 @@
+package mixer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SIMULATOR_TXNS_PATH      = "/api/transactions"
+	SIMULATOR_ADDRESSES_PATH = "/api/addresses/"
+	SIMULATOR_SEND_PATH      = "/send"
+	SIMULATOR_FAUCET_PATH    = "/faucet"
+)
+
+// Simulator is an in-memory Jobcoin ledger. It serves the same endpoints Wallet consumes
+// as an http.Handler, so it can sit behind an httptest.Server, but unlike a stubbed
+// JSONClient it keeps track of balances and refuses sends that would overdraw an address
+type Simulator struct {
+	mutex        sync.Mutex
+	transactions []*Transaction
+	balances     map[Address]Coin
+	path         string // if set, the ledger is written to this file after every change
+}
+
+func NewSimulator() *Simulator {
+	return &Simulator{
+		transactions: []*Transaction{},
+		balances:     map[Address]Coin{},
+	}
+}
+
+// LoadSimulator returns a Simulator that persists its ledger to path, starting from
+// whatever was previously saved there. A missing file is treated as an empty ledger
+func LoadSimulator(path string) (*Simulator, error) {
+	s := NewSimulator()
+	s.path = path
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var txns []*Transaction
+	err = json.Unmarshal(b, &txns)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse ledger file '%s': %s", path, err)
+	}
+
+	// balances aren't stored, they're rebuilt by replaying every transaction in order
+	for _, txn := range txns {
+		s.apply(txn)
+	}
+	return s, nil
+}
+
+type simulatorError struct {
+	Error string `json:"error"`
+}
+
+// create amount out of thin air and credit it to address. Minted transactions have
+// no source, which is how Jobcoin represents coins created through its faucet
+func (s *Simulator) Mint(address Address, amount Coin) (*Transaction, error) {
+	if address == "" {
+		return nil, ErrInvalidAddress
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount should be a positive integer value")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.balances[address].Add(amount); err != nil {
+		return nil, err
+	}
+	return s.record(Address(""), address, amount)
+}
+
+func (s *Simulator) Send(source, recipient Address, amount Coin) (*Transaction, error) {
+	if source == "" || recipient == "" {
+		return nil, ErrInvalidAddress
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount should be a positive integer value")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.balances[source] < amount {
+		return nil, ErrInsufficientFunds
+	}
+	if _, err := s.balances[recipient].Add(amount); err != nil {
+		return nil, err
+	}
+	return s.record(source, recipient, amount)
+}
+
+// callers must hold s.mutex. The transaction is only applied once it has been persisted
+func (s *Simulator) record(source, recipient Address, amount Coin) (*Transaction, error) {
+	// like the Jobcoin API, transactions aren't tagged with an asset
+	txn := &Transaction{time.Now().UTC(), source, recipient, amount, "", 0}
+
+	if s.path != "" {
+		txns := append([]*Transaction{}, s.transactions...)
+		err := s.save(append(txns, txn))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.apply(txn)
+	return txn, nil
+}
+
+func (s *Simulator) apply(txn *Transaction) {
+	s.transactions = append(s.transactions, txn)
+	if txn.Source != "" {
+		s.balances[txn.Source] -= txn.Amount
+	}
+	s.balances[txn.Recipient] += txn.Amount
+}
+
+// write to a temporary file first so a crash mid-write never leaves a truncated ledger
+func (s *Simulator) save(txns []*Transaction) error {
+	b, err := json.Marshal(txns)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, b)
+}
+
+// writeFileAtomic writes to a temporary file and renames it over path, so a crash
+// never leaves a half-written file behind
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *Simulator) Balance(address Address) Coin {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.balances[address]
+}
+
+func (s *Simulator) Transactions() []*Transaction {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	txns := make([]*Transaction, len(s.transactions))
+	copy(txns, s.transactions)
+	return txns
+}
+
+func (s *Simulator) addressTransactions(address Address) []*Transaction {
+	txns := []*Transaction{}
+	for _, txn := range s.transactions {
+		if txn.Source == address || txn.Recipient == address {
+			txns = append(txns, txn)
+		}
+	}
+	return txns
+}
+
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	switch {
+	case path == SIMULATOR_TXNS_PATH && r.Method == http.MethodGet:
+		writeSimulatorResponse(w, http.StatusOK, s.Transactions())
+
+	case strings.HasPrefix(path, SIMULATOR_ADDRESSES_PATH) && r.Method == http.MethodGet:
+		address := Address(strings.TrimPrefix(path, SIMULATOR_ADDRESSES_PATH))
+		s.mutex.Lock()
+		info := AddressInfo{s.balances[address], s.addressTransactions(address)}
+		s.mutex.Unlock()
+		writeSimulatorResponse(w, http.StatusOK, info)
+
+	case path == SIMULATOR_SEND_PATH && r.Method == http.MethodPost:
+		// the simulator speaks Jobcoin, whose coins have DEFAULT_PRECISION
+		send, err := DecodeSendRequest(r, DEFAULT_PRECISION)
+		if err != nil {
+			writeSimulatorResponse(w, http.StatusBadRequest, simulatorError{err.Error()})
+			return
+		}
+
+		_, err = s.Send(send.Source, send.Recipient, send.Amount)
+		if err == ErrInsufficientFunds {
+			writeSimulatorResponse(w, http.StatusUnprocessableEntity, simulatorError{err.Error()})
+			return
+		}
+		if err != nil {
+			writeSimulatorResponse(w, http.StatusBadRequest, simulatorError{err.Error()})
+			return
+		}
+		writeSimulatorResponse(w, http.StatusOK, map[string]string{"status": "OK"})
+
+	case path == SIMULATOR_FAUCET_PATH && r.Method == http.MethodPost:
+		mint, err := DecodeSendRequest(r, DEFAULT_PRECISION)
+		if err != nil {
+			writeSimulatorResponse(w, http.StatusBadRequest, simulatorError{err.Error()})
+			return
+		}
+
+		minted, err := s.Mint(mint.Recipient, mint.Amount)
+		if err != nil {
+			writeSimulatorResponse(w, http.StatusBadRequest, simulatorError{err.Error()})
+			return
+		}
+		writeSimulatorResponse(w, http.StatusOK, minted)
+
+	default:
+		writeSimulatorResponse(w, http.StatusNotFound, simulatorError{"Not Found"})
+	}
+}
+
+func writeSimulatorResponse(w http.ResponseWriter, status int, entity interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(entity)
+}
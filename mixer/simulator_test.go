@@ -0,0 +1,169 @@
+package mixer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// point a JobcoinLedger backed by a real ApiClient at an httptest server running sim
+func newSimulatedLedger(sim *Simulator) (*JobcoinLedger, *httptest.Server) {
+	server := httptest.NewServer(sim)
+	return NewJobcoinLedger(NewApiClient(), LocalNetwork().WithBaseURL(server.URL)), server
+}
+
+func TestSimulatorRejectsOverdraw(t *testing.T) {
+	fmt.Println("Running TestSimulatorRejectsOverdraw...")
+
+	ctx := context.Background()
+	sim := NewSimulator()
+	ledger, server := newSimulatedLedger(sim)
+	defer server.Close()
+
+	sim.Mint("Alice", Coin(1000))
+
+	err := ledger.SendTransaction(ctx, "Alice", "Bob", Coin(1500))
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected a send of 15.00 from an address holding 10.00 to fail with ErrInsufficientFunds, saw '%v'", err)
+	}
+
+	err = ledger.SendTransaction(ctx, "Alice", "", Coin(100))
+	if !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("Expected a send to an empty address to fail with ErrInvalidAddress, saw '%v'", err)
+	}
+
+	err = ledger.SendTransaction(ctx, "Alice", "Bob", Coin(400))
+	if err != nil {
+		t.Errorf("Simulator rejected a valid send. Saw error '%s' instead", err)
+	}
+
+	err = ledger.SendTransaction(ctx, "Bob", "Charles", Coin(401))
+	if err == nil {
+		t.Errorf("Simulator accepted a send of 4.01 from an address holding 4.00")
+	}
+
+	cases := []struct {
+		address Address
+		balance Coin
+	}{
+		{"Alice", Coin(600)},
+		{"Bob", Coin(400)},
+		{"Charles", Coin(0)},
+	}
+	for _, c := range cases {
+		balance, err := ledger.GetBalance(ctx, c.address)
+		if err != nil {
+			t.Errorf("JobcoinLedger.GetBalance(%s) returned unexpected error %s", c.address, err)
+		}
+		if balance != c.balance || sim.Balance(c.address) != c.balance {
+			t.Errorf("Expected balance of '%s' to be %v. Saw %v on the ledger and %v in the simulator",
+				c.address, c.balance, balance, sim.Balance(c.address))
+		}
+	}
+
+	if len(sim.Transactions()) != 2 {
+		t.Errorf("Expected 2 transactions on the simulated ledger, saw %d", len(sim.Transactions()))
+	}
+}
+
+func TestMixerRunSimulated(t *testing.T) {
+	fmt.Println("Running TestMixerRunSimulated...")
+
+	sim := NewSimulator()
+	ledger, server := newSimulatedLedger(sim)
+	defer server.Close()
+
+	amount := Coin(1200)
+	fee := Coin(200)
+	source := NewWallet(ledger, NewAddresses(1)[0])
+	recipients := NewAddresses(4)
+
+	batch := NewBatch(amount, fee, source, recipients, 1)
+	batch.DelayGenerator = func(maxDelay int) int {
+		return 0
+	}
+
+	sim.Mint("Alice", amount)
+	_, err := sim.Send("Alice", source.Address, amount)
+	if err != nil {
+		t.Fatalf("Could not fund tumbler address: %s", err)
+	}
+
+	pool := func(ledger Ledger) *Wallet {
+		return NewWallet(ledger, "Pool")
+	}
+	mixer := &Mixer{ledger, pool, []*Batch{batch}, &sync.WaitGroup{}, NewWatcher(ledger), nil, nil, nil, nil}
+	mixer.Run()
+
+	paidOut := Coin(0)
+	for _, recipient := range recipients {
+		paidOut += sim.Balance(recipient)
+	}
+
+	if paidOut != amount-fee {
+		t.Errorf("Expected recipients to receive %v in total, saw %v instead", (amount - fee).ToString(), paidOut.ToString())
+	}
+	if sim.Balance("Pool") != fee {
+		t.Errorf("Expected pool to keep fee %v, saw %v instead", fee.ToString(), sim.Balance("Pool").ToString())
+	}
+	if sim.Balance(source.Address) != 0 {
+		t.Errorf("Expected tumbler address to be empty, saw %v instead", sim.Balance(source.Address).ToString())
+	}
+}
+
+func TestLoadSimulatorPersistsLedger(t *testing.T) {
+	fmt.Println("Running TestLoadSimulatorPersistsLedger...")
+
+	dir, err := ioutil.TempDir("", "jobcoind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ledger.json")
+
+	sim, err := LoadSimulator(path)
+	if err != nil {
+		t.Fatalf("LoadSimulator returned unexpected error for a missing file: %s", err)
+	}
+	server := httptest.NewServer(sim)
+
+	faucet := bytes.NewBufferString(`{"toAddress":"Alice","amount":"10.00"}`)
+	response, err := http.Post(server.URL+SIMULATOR_FAUCET_PATH, "application/json", faucet)
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("Faucet request failed with response %v and error %v", response, err)
+	}
+	response.Body.Close()
+
+	_, err = sim.Send("Alice", "Bob", Coin(250))
+	if err != nil {
+		t.Fatalf("Simulator rejected a valid send. Saw error '%s' instead", err)
+	}
+	server.Close()
+
+	// a second simulator reading the same file should pick up where the first left off
+	reloaded, err := LoadSimulator(path)
+	if err != nil {
+		t.Fatalf("LoadSimulator returned unexpected error %s", err)
+	}
+
+	if len(reloaded.Transactions()) != 2 {
+		t.Errorf("Expected 2 transactions after reloading, saw %d", len(reloaded.Transactions()))
+	}
+	if reloaded.Balance("Alice") != Coin(750) || reloaded.Balance("Bob") != Coin(250) {
+		t.Errorf("Reloaded balances don't match: Alice has %v, Bob has %v",
+			reloaded.Balance("Alice").ToString(), reloaded.Balance("Bob").ToString())
+	}
+
+	_, err = reloaded.Send("Bob", "Alice", Coin(251))
+	if err == nil {
+		t.Errorf("Reloaded simulator accepted a send that overdraws Bob")
+	}
+}
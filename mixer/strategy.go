@@ -0,0 +1,221 @@
+package mixer
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	STRATEGY_HALVING = "halving"
+	STRATEGY_UNIFORM = "uniform"
+	STRATEGY_JITTER  = "jitter"
+	STRATEGY_MINIMUM = "minimum"
+
+	DEFAULT_STRATEGY = STRATEGY_HALVING
+
+	// how far an equal share can move either way under STRATEGY_JITTER
+	DEFAULT_JITTER_PERCENT = 25
+)
+
+// PayoutStrategy decides how a batch's payout is split between its recipients.
+// Split returns the amount for each recipient in order, summing to amount. A
+// recipient whose amount is 0, or who is past the end of the slice, isn't paid
+type PayoutStrategy interface {
+	Name() string
+	Split(amount Coin, recipients int) ([]Coin, error)
+}
+
+// NewPayoutStrategy returns the strategy called name. minimum is only used by
+// STRATEGY_MINIMUM, which guarantees it to every recipient
+func NewPayoutStrategy(name string, minimum Coin) (PayoutStrategy, error) {
+	switch name {
+	case STRATEGY_HALVING, "":
+		return HalvingStrategy{}, nil
+	case STRATEGY_UNIFORM:
+		return UniformStrategy{}, nil
+	case STRATEGY_JITTER:
+		return JitterStrategy{DEFAULT_JITTER_PERCENT}, nil
+	case STRATEGY_MINIMUM:
+		if minimum <= 0 {
+			return nil, fmt.Errorf("Minimum payout has to be positive")
+		}
+		return MinimumStrategy{minimum}, nil
+	}
+	return nil, fmt.Errorf("Unknown payout strategy '%s', expected one of: %v", name, PayoutStrategyNames())
+}
+
+func PayoutStrategyNames() []string {
+	return []string{STRATEGY_HALVING, STRATEGY_UNIFORM, STRATEGY_JITTER, STRATEGY_MINIMUM}
+}
+
+// strategyMinimum is what has to be journaled, along with its name, to rebuild strategy
+func strategyMinimum(strategy PayoutStrategy) Coin {
+	if strategy, ok := strategy.(MinimumStrategy); ok {
+		return strategy.Minimum
+	}
+	return Coin(0)
+}
+
+// HalvingStrategy successively takes a random payout between 1 and half of what's
+// left. Earlier recipients tend to get more, and once 1 is left the rest get nothing
+type HalvingStrategy struct{}
+
+func (s HalvingStrategy) Name() string {
+	return STRATEGY_HALVING
+}
+
+func (s HalvingStrategy) Split(amount Coin, totalRecipients int) ([]Coin, error) {
+	rand.Seed(time.Now().UnixNano())
+	payouts := []Coin{}
+
+	for i := 0; i < totalRecipients; i++ {
+		if (i + 1) == totalRecipients {
+			payouts = append(payouts, amount)
+		} else {
+			// successively take a random integer payout between (1, n/2 + 1) from amount
+			// and update amount with the new value
+			upperBound := int64(amount / 2)
+			if upperBound == 0 {
+				//if upperBound == 0 that imples amount was 1, so we can just add that
+				// payout value and early exit. Note that this implies that
+				// not every recipient account necessarily receives a payout
+				payouts = append(payouts, amount)
+				break
+			}
+			payout := Coin(rand.Int63n(upperBound) + 1)
+			payouts = append(payouts, payout)
+			amount -= payout
+		}
+	}
+
+	return payouts, nil
+}
+
+// UniformStrategy cuts amount at random points, so every way of splitting it is
+// equally likely whatever the recipient's position. Everyone gets something as long
+// as there's at least 1 for each recipient
+type UniformStrategy struct{}
+
+func (s UniformStrategy) Name() string {
+	return STRATEGY_UNIFORM
+}
+
+func (s UniformStrategy) Split(amount Coin, recipients int) ([]Coin, error) {
+	if recipients <= 0 {
+		return nil, nil
+	}
+
+	// n-1 distinct cuts strictly inside amount give n positive parts, when there's
+	// room for them. Otherwise cuts may coincide and some parts are 0
+	distinct := int64(amount) >= int64(recipients)
+	cuts := make([]int64, 0, recipients+1)
+	used := map[int64]bool{}
+	for len(cuts) < recipients-1 {
+		var cut int64
+		if distinct {
+			cut = rand.Int63n(int64(amount)-1) + 1
+			if used[cut] {
+				continue
+			}
+			used[cut] = true
+		} else {
+			cut = rand.Int63n(int64(amount) + 1)
+		}
+		cuts = append(cuts, cut)
+	}
+	cuts = append(cuts, 0, int64(amount))
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i] < cuts[j] })
+
+	payouts := make([]Coin, recipients)
+	for i := range payouts {
+		payouts[i] = Coin(cuts[i+1] - cuts[i])
+	}
+	return payouts, nil
+}
+
+// JitterStrategy splits amount equally, then moves a random part of each share, up
+// to Percent of it, to or from the next one so payouts aren't all the same
+type JitterStrategy struct {
+	Percent int64
+}
+
+func (s JitterStrategy) Name() string {
+	return STRATEGY_JITTER
+}
+
+func (s JitterStrategy) Split(amount Coin, recipients int) ([]Coin, error) {
+	if recipients <= 0 {
+		return nil, nil
+	}
+
+	share, remainder := amount/Coin(recipients), amount%Coin(recipients)
+	payouts := make([]Coin, recipients)
+	for i := range payouts {
+		payouts[i] = share
+		if Coin(i) < remainder {
+			payouts[i] += 1
+		}
+	}
+
+	jitter, err := share.Percent(s.Percent)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(payouts); i++ {
+		// keep both shares at 1 or more
+		low, high := -jitter, jitter
+		if low < 1-payouts[i] {
+			low = 1 - payouts[i]
+		}
+		if high > payouts[i+1]-1 {
+			high = payouts[i+1] - 1
+		}
+		if low >= high {
+			continue
+		}
+
+		moved := low + Coin(rand.Int63n(int64(high-low)+1))
+		payouts[i] += moved
+		payouts[i+1] -= moved
+	}
+
+	// the last share only ever moved towards the one before it, shuffle so it's no
+	// more predictable than the rest
+	rand.Shuffle(len(payouts), func(i, j int) { payouts[i], payouts[j] = payouts[j], payouts[i] })
+	return payouts, nil
+}
+
+// MinimumStrategy gives every recipient Minimum and splits the rest uniformly
+type MinimumStrategy struct {
+	Minimum Coin
+}
+
+func (s MinimumStrategy) Name() string {
+	return STRATEGY_MINIMUM
+}
+
+func (s MinimumStrategy) Split(amount Coin, recipients int) ([]Coin, error) {
+	if recipients <= 0 {
+		return nil, nil
+	}
+
+	guaranteed, err := s.Minimum.MulRatio(int64(recipients), 1)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := amount.Sub(guaranteed)
+	if err != nil || rest < 0 || s.Minimum <= 0 {
+		return nil, fmt.Errorf("Can't guarantee the minimum payout to each of %d recipients", recipients)
+	}
+
+	payouts, err := UniformStrategy{}.Split(rest, recipients)
+	if err != nil {
+		return nil, err
+	}
+	for i := range payouts {
+		payouts[i] += s.Minimum
+	}
+	return payouts, nil
+}
@@ -0,0 +1,92 @@
+package mixer
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPayoutStrategies(t *testing.T) {
+	fmt.Println("Running TestPayoutStrategies...")
+
+	cases := []struct {
+		amount     Coin
+		recipients int
+	}{
+		{Coin(1000), 4},
+		{Coin(7), 7},
+		{Coin(100000), 10},
+		{Coin(1), 1},
+	}
+
+	for _, name := range PayoutStrategyNames() {
+		strategy, err := NewPayoutStrategy(name, Coin(1))
+		if err != nil || strategy.Name() != name {
+			t.Fatalf("NewPayoutStrategy(%s) returned %v and error %v", name, strategy, err)
+		}
+
+		for _, c := range cases {
+			for i := 0; i < 100; i++ {
+				payouts, err := strategy.Split(c.amount, c.recipients)
+				if err != nil {
+					t.Fatalf("%s strategy returned unexpected error %s", name, err)
+				}
+				if len(payouts) > c.recipients {
+					t.Fatalf("%s strategy returned %d payouts for %d recipients", name, len(payouts), c.recipients)
+				}
+
+				sum := Coin(0)
+				for _, payout := range payouts {
+					if payout < 0 {
+						t.Fatalf("%s strategy returned a negative payout: %v", name, payouts)
+					}
+					// only the halving strategy is allowed to leave recipients out
+					if payout == 0 && name != STRATEGY_HALVING {
+						t.Fatalf("%s strategy left a recipient without a payout: %v", name, payouts)
+					}
+					sum += payout
+				}
+				if sum != c.amount {
+					t.Fatalf("%s strategy split %v into %v, which sums up to %v", name, c.amount, payouts, sum)
+				}
+			}
+		}
+	}
+}
+
+func TestMinimumStrategy(t *testing.T) {
+	fmt.Println("Running TestMinimumStrategy...")
+
+	strategy := MinimumStrategy{Coin(50)}
+	payouts, err := strategy.Split(Coin(200), 4)
+	if err != nil {
+		t.Fatalf("MinimumStrategy.Split returned unexpected error %s", err)
+	}
+	for _, payout := range payouts {
+		if payout != Coin(50) {
+			t.Errorf("Expected every recipient to get exactly the minimum, saw %v", payouts)
+		}
+	}
+
+	_, err = strategy.Split(Coin(199), 4)
+	if err == nil {
+		t.Errorf("Expected MinimumStrategy.Split to fail when the minimum doesn't fit")
+	}
+
+	// a batch whose minimum doesn't fit is turned down before anything is deposited
+	ledger := &testLedger{}
+	mixer := NewMixer(ledger, nil)
+	_, err = mixer.NewBatch(NewWallet(ledger, "Tumbler"), NewAmount(Coin(100), DEFAULT_ASSET, DEFAULT_PRECISION),
+		NewDestinations([]Address{"Bob", "Charles"}), 1, MinimumStrategy{Coin(500)})
+	if err == nil || len(mixer.Batches) != 0 {
+		t.Errorf("Expected Mixer.NewBatch to reject a minimum of 5.00 for 2 recipients of 1.00")
+	}
+
+	_, err = NewPayoutStrategy(STRATEGY_MINIMUM, Coin(0))
+	if err == nil {
+		t.Errorf("Expected NewPayoutStrategy to reject a minimum of 0")
+	}
+	_, err = NewPayoutStrategy("biggest-first", Coin(0))
+	if err == nil {
+		t.Errorf("Expected NewPayoutStrategy to reject an unknown strategy")
+	}
+}
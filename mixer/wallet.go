@@ -2,10 +2,15 @@ package mixer
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"math/big"
 	"math/rand"
 	"net/http"
 	"strconv"
@@ -13,11 +18,6 @@ import (
 	"time"
 )
 
-var (
-	FETCH_TXNS_URL = "http://jobcoin.gemini.com/victory/api/transactions"
-	SEND_TXN_URL   = "http://jobcoin.gemini.com/victory/send"
-)
-
 type Address string
 
 func NewAddress(address string) Address {
@@ -36,20 +36,23 @@ func NewAddresses(total int) (addresses []Address) {
 	return addresses
 }
 
-type Coin int64 // Jobcoin values are processed internally as cents
+// Coin is an amount in the smallest unit of a network. Jobcoin has 2 decimal places,
+// so by default a Coin is a number of cents. Networks with a different Precision parse
+// and format their amounts with ParseCoin and Coin.Format
+type Coin int64
+
+// the precision Coin's JSON encoding, CoinFromString and ToString use. The journal
+// reads back exactly what it wrote at any precision, but plans and log lines are
+// formatted with the precision of the batch's ledger, see PrecisionOf
+const DEFAULT_PRECISION = 2
 
 func (c Coin) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.ToString())
 }
 
+// UnmarshalJSON accepts amounts written as strings ("10.50") or numbers (10.5)
 func (c *Coin) UnmarshalJSON(b []byte) error {
-	var raw string
-	err := json.Unmarshal(b, &raw)
-	if err != nil {
-		return err
-	}
-
-	value, err := CoinFromString(raw)
+	value, err := decodeCoin(b, DEFAULT_PRECISION)
 	if err != nil {
 		return err
 	}
@@ -57,49 +60,137 @@ func (c *Coin) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func decodeCoin(b []byte, precision int) (Coin, error) {
+	// a missing or null amount is nothing at all
+	if len(b) == 0 || string(b) == "null" {
+		return 0, nil
+	}
+
+	var raw string
+	if json.Unmarshal(b, &raw) != nil {
+		var number json.Number
+		err := json.Unmarshal(b, &number)
+		if err != nil {
+			return 0, fmt.Errorf("Amount %s is neither a string nor a number", b)
+		}
+		raw = number.String()
+	}
+	return ParseCoin(raw, precision)
+}
+
 // convert Jobcoin to internal cents representation. 10.00 -> 1000
 // only used when reading data from external sources, never internally
 func CoinFromString(amount string) (Coin, error) {
-	index := strings.Index(amount, ".")
+	return ParseCoin(amount, DEFAULT_PRECISION)
+}
 
-	if index >= 0 {
-		padding := (len(amount) - (index + 1))
-		if padding < 2 {
-			for i := 0; i < padding; i++ {
-				amount = fmt.Sprintf("%s0", amount)
-			}
+// ParseCoin converts a decimal amount to a Coin with precision decimal places, so
+// "10.5" is 1050 at a precision of 2. Parsing is strict: an amount with more decimal
+// places than precision, an exponent, or anything but an optional sign and digits
+// is rejected rather than rounded
+func ParseCoin(amount string, precision int) (Coin, error) {
+	invalid := fmt.Errorf("Amount '%s' is not a valid decimal with at most %d decimal places", amount, precision)
+
+	digits := amount
+	negative := strings.HasPrefix(digits, "-")
+	if negative {
+		digits = digits[1:]
+	}
+
+	whole, fraction := digits, ""
+	if index := strings.Index(digits, "."); index >= 0 {
+		whole, fraction = digits[:index], digits[index+1:]
+		if fraction == "" {
+			return 0, invalid
 		}
-		amount = strings.Replace(amount, ".", "", 1)
-	} else {
-		amount = fmt.Sprintf("%s00", amount)
 	}
+	if whole == "" || len(fraction) > precision || !isDigits(whole) || !isDigits(fraction) {
+		return 0, invalid
+	}
+	fraction += strings.Repeat("0", precision-len(fraction))
 
-	val, err := strconv.ParseInt(amount, 10, 64)
+	val, err := strconv.ParseInt(whole+fraction, 10, 64)
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("Amount '%s' is out of range", amount)
+	}
+	if negative {
+		val = -val
 	}
-
 	return Coin(val), nil
 }
 
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // convert internal cents representation to Jobcoin representation. 1000 -> 10.00
 func (c Coin) ToString() string {
-	var whole, decimal string
-
-	cents := fmt.Sprintf("%v", c)
-	size := len(cents)
-	if size <= 2 {
-		whole = "0"
-		if size == 1 {
-			decimal = fmt.Sprintf("0%v", cents)
-		} else {
-			decimal = cents
-		}
-	} else {
-		whole = cents[:size-2]
-		decimal = cents[size-2:]
+	return c.Format(DEFAULT_PRECISION)
+}
+
+// Format writes c as a decimal with precision decimal places. ParseCoin reads it back
+// to the same Coin
+func (c Coin) Format(precision int) string {
+	sign := ""
+	units := strconv.FormatUint(uint64(c), 10)
+	if c < 0 {
+		sign = "-"
+		units = strconv.FormatUint(uint64(-c), 10)
+	}
+	if precision <= 0 {
+		return sign + units
 	}
-	return fmt.Sprintf("%v.%v", whole, decimal)
+
+	if len(units) <= precision {
+		units = strings.Repeat("0", precision-len(units)+1) + units
+	}
+	split := len(units) - precision
+	return fmt.Sprintf("%s%s.%s", sign, units[:split], units[split:])
+}
+
+var ErrCoinOverflow = errors.New("Coin Overflow")
+
+// Add returns c + other, or ErrCoinOverflow if the sum doesn't fit in a Coin
+func (c Coin) Add(other Coin) (Coin, error) {
+	sum := c + other
+	if (other > 0 && sum < c) || (other < 0 && sum > c) {
+		return 0, fmt.Errorf("%w: %d + %d", ErrCoinOverflow, c, other)
+	}
+	return sum, nil
+}
+
+// Sub returns c - other, or ErrCoinOverflow if the difference doesn't fit in a Coin
+func (c Coin) Sub(other Coin) (Coin, error) {
+	difference := c - other
+	if (other > 0 && difference > c) || (other < 0 && difference < c) {
+		return 0, fmt.Errorf("%w: %d - %d", ErrCoinOverflow, c, other)
+	}
+	return difference, nil
+}
+
+// MulRatio returns c * numerator / denominator rounded towards zero. The product is
+// computed exactly, so it only fails if the result itself doesn't fit in a Coin
+func (c Coin) MulRatio(numerator, denominator int64) (Coin, error) {
+	if denominator == 0 {
+		return 0, fmt.Errorf("Can't multiply %d by %d/0", c, numerator)
+	}
+
+	result := new(big.Int).Mul(big.NewInt(int64(c)), big.NewInt(numerator))
+	result.Quo(result, big.NewInt(denominator))
+	if !result.IsInt64() {
+		return 0, fmt.Errorf("%w: %d * %d / %d", ErrCoinOverflow, c, numerator, denominator)
+	}
+	return Coin(result.Int64()), nil
+}
+
+// Percent returns percent% of c, rounded towards zero
+func (c Coin) Percent(percent int64) (Coin, error) {
+	return c.MulRatio(percent, 100)
 }
 
 type JSONClient interface {
@@ -107,64 +198,157 @@ type JSONClient interface {
 	JSONPostRequest(url string, payload *bytes.Buffer) error
 }
 
+// ContextJSONClient is a JSONClient whose requests can be cancelled or bounded by a
+// deadline. JobcoinLedger uses the context-aware methods whenever its client has them
+type ContextJSONClient interface {
+	JSONClient
+	JSONGetRequestContext(ctx context.Context, url string) ([]byte, error)
+	JSONPostRequestContext(ctx context.Context, url string, payload *bytes.Buffer) error
+}
+
+// PostClient is implemented by clients that can post bodies other than JSON, such as
+// the form encoded sends some networks expect
+type PostClient interface {
+	PostRequestContext(ctx context.Context, url, contentType string, payload *bytes.Buffer) error
+}
+
+// ApiClient is a JSONClient for the Jobcoin HTTP API. Requests time out after
+// REQUEST_TIMEOUT, failed requests are retried according to Retry, Breaker stops
+// all requests for a while once the ledger looks unhealthy, and Limiter keeps
+// requests within the ledger's rate limits
 type ApiClient struct {
 	*http.Client
+	Retry   *RetryPolicy
+	Breaker *CircuitBreaker
+	Limiter *RateLimiter
 }
 
 func NewApiClient() *ApiClient {
-	return &ApiClient{&http.Client{}}
+	return &ApiClient{
+		&http.Client{Timeout: REQUEST_TIMEOUT},
+		NewRetryPolicy(),
+		NewCircuitBreaker(),
+		SharedRateLimiter,
+	}
 }
 
 func (a *ApiClient) JSONGetRequest(url string) ([]byte, error) {
+	return a.JSONGetRequestContext(context.Background(), url)
+}
+
+func (a *ApiClient) JSONGetRequestContext(ctx context.Context, url string) ([]byte, error) {
+	return a.withRetries(ctx, retryableGet, func() ([]byte, error) {
+		return a.request(ctx, "GET", url, "", nil)
+	})
+}
+
+func (a *ApiClient) JSONPostRequest(url string, payload *bytes.Buffer) error {
+	return a.JSONPostRequestContext(context.Background(), url, payload)
+}
+
+func (a *ApiClient) JSONPostRequestContext(ctx context.Context, url string, payload *bytes.Buffer) error {
+	return a.PostRequestContext(ctx, url, CONTENT_TYPE_JSON, payload)
+}
+
+func (a *ApiClient) PostRequestContext(ctx context.Context, url, contentType string, payload *bytes.Buffer) error {
+	// the payload is read once up front so every attempt sends the same body
+	body := payload.Bytes()
+	_, err := a.withRetries(ctx, retryableSend, func() ([]byte, error) {
+		return a.request(ctx, "POST", url, contentType, body)
+	})
+	return err
+}
+
+func (a *ApiClient) withRetries(ctx context.Context, retryable func(error) bool, request func() ([]byte, error)) ([]byte, error) {
+	attempts := 1
+	if a.Retry != nil && a.Retry.MaxAttempts > 1 {
+		attempts = a.Retry.MaxAttempts
+	}
+
 	var byteStream []byte
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			err = sleepContext(ctx, a.Retry.Backoff(attempt-1))
+			if err != nil {
+				return byteStream, err
+			}
+		}
 
-	request, err := http.NewRequest(
-		"GET",
-		url,
-		nil,
-	)
-	if err != nil {
-		return byteStream, err
+		byteStream, err = request()
+		if err == nil || ctx.Err() != nil || !retryable(err) {
+			break
+		}
 	}
+	return byteStream, err
+}
 
-	response, err := a.Do(request)
-	if err != nil {
-		return byteStream, err
+// request makes a single attempt, passing it through the rate limiter and circuit breaker
+func (a *ApiClient) request(ctx context.Context, method, url, contentType string, body []byte) ([]byte, error) {
+	if a.Limiter != nil {
+		kind := READ_REQUEST
+		if method == "POST" {
+			kind = SEND_REQUEST
+		}
+
+		err := a.Limiter.Wait(ctx, kind)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if response.StatusCode != http.StatusOK {
-		return byteStream, fmt.Errorf(
-			"Url: '%s' returned unexpected status code %d", url, response.StatusCode)
+	if a.Breaker != nil {
+		err := a.Breaker.Allow()
+		if err != nil {
+			return nil, err
+		}
 	}
-	reader := response.Body
-	defer reader.Close()
 
-	return ioutil.ReadAll(reader)
+	byteStream, err := a.do(ctx, method, url, contentType, body)
+	if a.Breaker != nil {
+		if ctx.Err() != nil {
+			a.Breaker.Abandon()
+		} else {
+			a.Breaker.Record(err)
+		}
+	}
+	return byteStream, err
 }
 
-func (a *ApiClient) JSONPostRequest(url string, payload *bytes.Buffer) error {
-	request, err := http.NewRequest(
-		"POST",
+func (a *ApiClient) do(ctx context.Context, method, url, contentType string, body []byte) ([]byte, error) {
+	var byteStream []byte
+
+	var payload io.Reader
+	if body != nil {
+		payload = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequestWithContext(
+		ctx,
+		method,
 		url,
 		payload,
 	)
 	if err != nil {
-		return err
+		return byteStream, err
 	}
 
-	request.Header.Set("Content-Type", "application/json")
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
 	response, err := a.Do(request)
 	if err != nil {
-		return err
+		return byteStream, err
 	}
-	defer response.Body.Close()
+	reader := response.Body
+	defer reader.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf(
-			"POST json request to url '%s' returned unexpected status code %d", url, response.StatusCode)
+		errorBody, _ := ioutil.ReadAll(reader)
+		return byteStream, newLedgerError(method, url, response.StatusCode, errorBody)
 	}
 
-	return nil
+	return ioutil.ReadAll(reader)
 }
 
 type Transaction struct {
@@ -172,45 +356,81 @@ type Transaction struct {
 	Source    Address   `json:"fromAddress"`
 	Recipient Address   `json:"toAddress"`
 	Amount    Coin      `json:"amount"`
+	Asset     Asset     `json:"asset,omitempty"`
+
+	// Jobcoin doesn't give transactions an identifier, so exact duplicates are told
+	// apart by the order they appear in. Set by AssignOccurrences
+	Occurrence int `json:"-"`
+}
+
+func (t *Transaction) fingerprint() string {
+	return fmt.Sprintf(
+		"%s|%s|%s|%d|%s", t.Timestamp.UTC().Format(time.RFC3339Nano), t.Source, t.Recipient, t.Amount, t.Asset)
+}
+
+// ID is a stable identifier for t, a hash of its timestamp, addresses, amount, asset
+// and occurrence index. It's the same every time t is read from the ledger
+func (t *Transaction) ID() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", t.fingerprint(), t.Occurrence)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// AssignOccurrences numbers the exact duplicates in txns in the order they appear.
+// Identical transactions always share a recipient, so the numbering is the same
+// whether txns is the whole ledger or a single address's history
+func AssignOccurrences(txns []*Transaction) {
+	seen := map[string]int{}
+	for _, txn := range txns {
+		key := txn.fingerprint()
+		txn.Occurrence = seen[key]
+		seen[key] += 1
+	}
+}
+
+// AddressInfo is the response of the ADDRESS INFO endpoint: the current balance of an
+// address and every transaction it was the source or recipient of
+type AddressInfo struct {
+	Balance      Coin           `json:"balance"`
+	Transactions []*Transaction `json:"transactions"`
 }
 
 type Wallet struct {
-	client  JSONClient
+	ledger  Ledger
 	Address Address
 }
 
-func NewWallet(address Address) *Wallet {
+func NewWallet(ledger Ledger, address Address) *Wallet {
 	return &Wallet{
-		NewApiClient(), address,
+		ledger, address,
 	}
 }
 
+// format writes amount with as many decimal places as w's ledger has
+func (w *Wallet) format(amount Coin) string {
+	return amount.Format(PrecisionOf(w.ledger))
+}
+
 func (w *Wallet) SendTransaction(recipient Address, amount Coin) error {
+	return w.SendTransactionContext(context.Background(), recipient, amount)
+}
+
+func (w *Wallet) SendTransactionContext(ctx context.Context, recipient Address, amount Coin) error {
 	if amount <= 0 {
 		return fmt.Errorf("amount should be a positive integer value")
 	}
 
-	fmt.Printf("Sending amount '%v' to recipient '%s'\n", amount.ToString(), recipient)
-	txn := Transaction{time.Now(), w.Address, recipient, amount}
-	serializedTxn, err := json.Marshal(txn)
-	if err != nil {
-		log.Panic(err)
-	}
-
-	txnBuffer := bytes.NewBuffer(serializedTxn)
-	err = w.client.JSONPostRequest(SEND_TXN_URL, txnBuffer)
-	if err != nil {
-		log.Panic(err)
-	}
-
-	return nil
+	fmt.Printf("Sending amount '%v' to recipient '%s'\n", w.format(amount), recipient)
+	return w.ledger.SendTransaction(ctx, w.Address, recipient, amount)
 }
 
 func (w *Wallet) GetTransactions(cutoff time.Time) ([]*Transaction, error) {
-	var allTxns []*Transaction
+	return w.GetTransactionsContext(context.Background(), cutoff)
+}
+
+func (w *Wallet) GetTransactionsContext(ctx context.Context, cutoff time.Time) ([]*Transaction, error) {
 	var newTxns []*Transaction
 
-	// I chose to just use the FETCH_TXNS_URL endpoint because it simplifies the number
+	// I chose to just use the transactions endpoint because it simplifies the number
 	// of core data structures in the app (just Transaction and Coin are enough for all
 	// interactions with the external world) and this behavior is more reflective of how
 	// polling a real blockchain would work. There's obviously a performance hit for making
@@ -219,17 +439,35 @@ func (w *Wallet) GetTransactions(cutoff time.Time) ([]*Transaction, error) {
 	// but it simplified the development process and this solution could easily scale to several
 	// tens-hundreds of thousands of transaction records being returned per call without any problems.
 
-	b, err := w.client.JSONGetRequest(FETCH_TXNS_URL)
+	allTxns, err := w.ledger.GetTransactions(ctx)
 	if err != nil {
 		return allTxns, err
 	}
 
-	err = json.Unmarshal(b, &allTxns)
+	for _, txn := range allTxns {
+		if (txn.Recipient == w.Address) && txn.Timestamp.After(cutoff) {
+			fmt.Printf("New txn seen: %v\n", txn)
+			newTxns = append(newTxns, txn)
+		}
+	}
+	return newTxns, nil
+}
+
+// same as GetTransactions, but only downloads the transactions involving w.Address
+// through the ADDRESS INFO endpoint instead of the whole ledger
+func (w *Wallet) GetAddressTransactions(cutoff time.Time) ([]*Transaction, error) {
+	return w.GetAddressTransactionsContext(context.Background(), cutoff)
+}
+
+func (w *Wallet) GetAddressTransactionsContext(ctx context.Context, cutoff time.Time) ([]*Transaction, error) {
+	var newTxns []*Transaction
+
+	info, err := w.InfoContext(ctx)
 	if err != nil {
-		return allTxns, err
+		return newTxns, err
 	}
 
-	for _, txn := range allTxns {
+	for _, txn := range info.Transactions {
 		if (txn.Recipient == w.Address) && txn.Timestamp.After(cutoff) {
 			fmt.Printf("New txn seen: %v\n", txn)
 			newTxns = append(newTxns, txn)
@@ -237,3 +475,23 @@ func (w *Wallet) GetTransactions(cutoff time.Time) ([]*Transaction, error) {
 	}
 	return newTxns, nil
 }
+
+func (w *Wallet) Info() (*AddressInfo, error) {
+	return w.InfoContext(context.Background())
+}
+
+func (w *Wallet) InfoContext(ctx context.Context) (*AddressInfo, error) {
+	return w.ledger.GetAddressInfo(ctx, w.Address)
+}
+
+func (w *Wallet) Balance() (Coin, error) {
+	return w.BalanceContext(context.Background())
+}
+
+func (w *Wallet) BalanceContext(ctx context.Context) (Coin, error) {
+	info, err := w.InfoContext(ctx)
+	if err != nil {
+		return Coin(0), err
+	}
+	return info.Balance, nil
+}
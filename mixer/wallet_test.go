@@ -2,9 +2,12 @@ package mixer
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -31,6 +34,10 @@ func (t *testClient) JSONPostRequest(url string, payload *bytes.Buffer) error {
 	return t.PostResponse(url, payload)
 }
 
+func (t *testClient) PostRequestContext(ctx context.Context, url, contentType string, payload *bytes.Buffer) error {
+	return t.PostResponse(url, payload)
+}
+
 func TestNewAddresses(t *testing.T) {
 	fmt.Println("Running TestNewAddresses...")
 
@@ -46,7 +53,7 @@ func TestWalletSendTransaction(t *testing.T) {
 	client := &testClient{
 		PostResponse: func(url string, payload *bytes.Buffer) error { return nil },
 	}
-	w := &Wallet{client, "Alice"}
+	w := &Wallet{NewJobcoinLedger(client, VictoryNetwork()), "Alice"}
 	b := Address("Bob")
 
 	cases := []struct {
@@ -90,12 +97,16 @@ func TestWalletGetTransactions(t *testing.T) {
 			"Alice",
 			"Bob",
 			amount,
+			DEFAULT_ASSET,
+			0,
 		},
 		&Transaction{
 			future,
 			"Alice",
 			"Bob",
 			amount,
+			DEFAULT_ASSET,
+			0,
 		},
 	}
 
@@ -105,7 +116,7 @@ func TestWalletGetTransactions(t *testing.T) {
 		},
 	}
 
-	w := &Wallet{client, "Bob"}
+	w := &Wallet{NewJobcoinLedger(client, VictoryNetwork()), "Bob"}
 	returnedTxns, err := w.GetTransactions(now)
 	if err != nil {
 		t.Errorf("Did not successfully fetch transactions. Saw error '%s' instead", err)
@@ -127,6 +138,48 @@ func TestWalletGetTransactions(t *testing.T) {
 	}
 }
 
+func TestWalletGetAddressTransactions(t *testing.T) {
+	fmt.Println("Running TestWalletGetAddressTransactions...")
+
+	now := time.Now()
+	past := now.Add(time.Duration(-1000) * time.Second)
+	future := now.Add(time.Duration(1000) * time.Second)
+
+	info := &AddressInfo{
+		Coin(1500),
+		[]*Transaction{
+			&Transaction{past, "Alice", "Bob", Coin(1000), DEFAULT_ASSET, 0},
+			&Transaction{future, "Bob", "Charles", Coin(500), DEFAULT_ASSET, 0},
+			&Transaction{future, "Alice", "Bob", Coin(1000), DEFAULT_ASSET, 0},
+		},
+	}
+
+	client := &testClient{
+		GetResponse: func(url string) ([]byte, error) {
+			if url != VictoryNetwork().AddressURL("Bob") {
+				t.Errorf("Wallet.GetAddressTransactions requested unexpected url '%s'", url)
+			}
+			return json.Marshal(info)
+		},
+	}
+
+	w := &Wallet{NewJobcoinLedger(client, VictoryNetwork()), "Bob"}
+	returnedTxns, err := w.GetAddressTransactions(now)
+	if err != nil {
+		t.Errorf("Did not successfully fetch transactions. Saw error '%s' instead", err)
+	}
+
+	// only the inbound transaction after the cutoff counts, not the outbound one to Charles
+	if len(returnedTxns) != 1 || returnedTxns[0].Source != "Alice" {
+		t.Errorf("Expected a single new transaction from Alice, saw %v instead", returnedTxns)
+	}
+
+	balance, err := w.Balance()
+	if err != nil || balance != Coin(1500) {
+		t.Errorf("Wallet.Balance() returned %v and error %v, expected 15.00", balance, err)
+	}
+}
+
 func mockHandler(status int, entity interface{}) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if status != 0 {
@@ -295,3 +348,148 @@ func TestCoinToString(t *testing.T) {
 		}
 	}
 }
+
+func TestTransactionID(t *testing.T) {
+	fmt.Println("Running TestTransactionID...")
+
+	timestamp := time.Now()
+	txns := []*Transaction{
+		&Transaction{timestamp, "Alice", "Bob", Coin(100), DEFAULT_ASSET, 0},
+		&Transaction{timestamp, "Alice", "Charles", Coin(100), DEFAULT_ASSET, 0},
+		&Transaction{timestamp, "Alice", "Bob", Coin(100), DEFAULT_ASSET, 0},
+	}
+	AssignOccurrences(txns)
+
+	if txns[0].ID() == txns[2].ID() {
+		t.Errorf("Expected exact duplicates to have different IDs, both were %s", txns[0].ID())
+	}
+	if txns[0].ID() == txns[1].ID() {
+		t.Errorf("Expected transactions to different recipients to have different IDs")
+	}
+
+	// the same transactions read back from the ledger have the same IDs
+	b, _ := json.Marshal(txns)
+	var decoded []*Transaction
+	json.Unmarshal(b, &decoded)
+	AssignOccurrences(decoded)
+
+	for i := range txns {
+		if txns[i].ID() != decoded[i].ID() {
+			t.Errorf("Expected ID %s to survive a round trip, saw %s", txns[i].ID(), decoded[i].ID())
+		}
+	}
+}
+
+func TestParseCoin(t *testing.T) {
+	fmt.Println("Running TestParseCoin...")
+
+	cases := []struct {
+		input     string
+		precision int
+		output    Coin
+		valid     bool
+	}{
+		{"-0.5", 2, Coin(-50), true},
+		{"-12", 2, Coin(-1200), true},
+		{"1.23456789", 8, Coin(123456789), true},
+		{"42", 0, Coin(42), true},
+		{"1.234", 2, Coin(0), false},
+		{"1.5", 0, Coin(0), false},
+		{"1.", 2, Coin(0), false},
+		{".5", 2, Coin(0), false},
+		{"", 2, Coin(0), false},
+		{"-", 2, Coin(0), false},
+		{"--1", 2, Coin(0), false},
+		{"+1", 2, Coin(0), false},
+		{"1e2", 2, Coin(0), false},
+		{"1,000", 2, Coin(0), false},
+		{"99999999999999999999", 2, Coin(0), false},
+	}
+
+	for _, c := range cases {
+		actual, err := ParseCoin(c.input, c.precision)
+		if c.valid && (err != nil || actual != c.output) {
+			t.Errorf("ParseCoin(%q, %d) returned %v and error %v, expected %v", c.input, c.precision, actual, err, c.output)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("ParseCoin(%q, %d) unexpectedly returned %v", c.input, c.precision, actual)
+		}
+	}
+}
+
+func TestCoinFormatRoundTrip(t *testing.T) {
+	fmt.Println("Running TestCoinFormatRoundTrip...")
+
+	for _, precision := range []int{0, 2, 8} {
+		for _, c := range []Coin{Coin(0), Coin(1), Coin(-1), Coin(-50), Coin(123456789), Coin(math.MaxInt64), Coin(math.MinInt64 + 1)} {
+			formatted := c.Format(precision)
+			parsed, err := ParseCoin(formatted, precision)
+			if err != nil || parsed != c {
+				t.Errorf("%d formatted at precision %d as %q parsed back to %v and error %v", c, precision, formatted, parsed, err)
+			}
+		}
+	}
+
+	if formatted := Coin(-50).ToString(); formatted != "-0.50" {
+		t.Errorf("Expected Coin(-50).ToString() to return -0.50, saw %s", formatted)
+	}
+}
+
+func TestCoinUnmarshalJSON(t *testing.T) {
+	fmt.Println("Running TestCoinUnmarshalJSON...")
+
+	var amounts []Coin
+	err := json.Unmarshal([]byte(`["10.50", 10.5, 3, null]`), &amounts)
+	if err != nil {
+		t.Fatalf("Could not unmarshal string and numeric amounts: %s", err)
+	}
+	if fmt.Sprint(amounts) != fmt.Sprint([]Coin{1050, 1050, 300, 0}) {
+		t.Errorf("Unexpected amounts %v", amounts)
+	}
+
+	var amount Coin
+	for _, invalid := range []string{`"1.234"`, `1.234`, `true`, `{}`} {
+		if json.Unmarshal([]byte(invalid), &amount) == nil {
+			t.Errorf("Expected amount %s to be rejected", invalid)
+		}
+	}
+}
+
+func TestCoinArithmetic(t *testing.T) {
+	fmt.Println("Running TestCoinArithmetic...")
+
+	max := Coin(math.MaxInt64)
+	min := Coin(math.MinInt64)
+
+	if sum, err := Coin(100).Add(Coin(250)); err != nil || sum != Coin(350) {
+		t.Errorf("Expected 1.00 + 2.50 to be 3.50, saw %v and error %v", sum, err)
+	}
+	if difference, err := Coin(100).Sub(Coin(250)); err != nil || difference != Coin(-150) {
+		t.Errorf("Expected 1.00 - 2.50 to be -1.50, saw %v and error %v", difference, err)
+	}
+
+	overflows := []func() (Coin, error){
+		func() (Coin, error) { return max.Add(Coin(1)) },
+		func() (Coin, error) { return min.Add(Coin(-1)) },
+		func() (Coin, error) { return min.Sub(Coin(1)) },
+		func() (Coin, error) { return Coin(0).Sub(min) },
+		func() (Coin, error) { return max.MulRatio(2, 1) },
+		func() (Coin, error) { return max.Percent(101) },
+	}
+	for i, overflow := range overflows {
+		if _, err := overflow(); !errors.Is(err, ErrCoinOverflow) {
+			t.Errorf("Expected case %d to fail with ErrCoinOverflow, saw %v", i, err)
+		}
+	}
+
+	// the intermediate product is exact even when it wouldn't fit in a Coin
+	if fee, err := max.Percent(20); err != nil || fee != Coin(int64(math.MaxInt64)/5) {
+		t.Errorf("Expected 20%% of the largest Coin to be %d, saw %v and error %v", int64(math.MaxInt64)/5, fee, err)
+	}
+	if fee, err := Coin(1999).Percent(20); err != nil || fee != Coin(399) {
+		t.Errorf("Expected 20%% of 19.99 to round down to 3.99, saw %v and error %v", fee, err)
+	}
+	if _, err := Coin(100).MulRatio(1, 0); err == nil {
+		t.Errorf("Expected a zero denominator to be rejected")
+	}
+}
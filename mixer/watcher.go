@@ -0,0 +1,119 @@
+package mixer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type subscription struct {
+	address      Address
+	transactions chan *Transaction
+	done         chan struct{}
+}
+
+// Watcher monitors any number of addresses with a single poll loop. Callers Subscribe
+// to an address and receive every new Transaction sent to it on a channel. Transactions
+// come from a shared TransactionIndex when polling, or can be pushed in with Publish by
+// a source that is notified of transactions directly
+type Watcher struct {
+	mutex         sync.Mutex
+	Index         *TransactionIndex
+	PollInterval  time.Duration
+	subscriptions map[Address][]*subscription
+}
+
+func NewWatcher(ledger Ledger) *Watcher {
+	return &Watcher{
+		Index:         NewTransactionIndex(ledger),
+		PollInterval:  DEFAULT_POLL_INTERVAL,
+		subscriptions: map[Address][]*subscription{},
+	}
+}
+
+func (w *Watcher) Subscribe(address Address) <-chan *Transaction {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	sub := &subscription{address, make(chan *Transaction, 16), make(chan struct{})}
+	w.subscriptions[address] = append(w.subscriptions[address], sub)
+	return sub.transactions
+}
+
+// Unsubscribe stops delivery on a channel returned by Subscribe. Transactions that
+// were being delivered to it at the time are dropped
+func (w *Watcher) Unsubscribe(address Address, transactions <-chan *Transaction) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	subs := w.subscriptions[address]
+	for i, sub := range subs {
+		if sub.transactions == transactions {
+			close(sub.done)
+			w.subscriptions[address] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+
+	if len(w.subscriptions[address]) == 0 {
+		delete(w.subscriptions, address)
+	}
+}
+
+func (w *Watcher) addresses() []Address {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var addresses []Address
+	for address := range w.subscriptions {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// Poll refreshes the index once and hands every new transaction sent to a subscribed
+// address to its subscribers
+func (w *Watcher) Poll(ctx context.Context) error {
+	err := w.Index.Refresh(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, address := range w.addresses() {
+		w.Publish(w.Index.Transactions(address, time.Time{})...)
+	}
+	return nil
+}
+
+// Publish delivers txns to the subscribers of their recipients. It's used by Poll, and
+// by push sources in place of running the poll loop
+func (w *Watcher) Publish(txns ...*Transaction) {
+	for _, txn := range txns {
+		w.mutex.Lock()
+		subs := append([]*subscription{}, w.subscriptions[txn.Recipient]...)
+		w.mutex.Unlock()
+
+		// the lock isn't held while sending so a slow subscriber can still unsubscribe
+		for _, sub := range subs {
+			select {
+			case sub.transactions <- txn:
+			case <-sub.done:
+			}
+		}
+	}
+}
+
+// Run polls every PollInterval until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	for {
+		err := w.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("Could not poll for new transactions: %s\n", err)
+		}
+
+		if sleepContext(ctx, w.PollInterval) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mixer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, transactions <-chan *Transaction) *Transaction {
+	select {
+	case txn := <-transactions:
+		return txn
+	case <-time.After(TIMEOUT):
+		t.Fatalf("Timed out waiting for a transaction")
+	}
+	return nil
+}
+
+func TestWatcherPoll(t *testing.T) {
+	fmt.Println("Running TestWatcherPoll...")
+
+	ctx := context.Background()
+	ledger := &testLedger{}
+	watcher := NewWatcher(ledger)
+
+	bob := watcher.Subscribe("Bob")
+	charles := watcher.Subscribe("Charles")
+	otherBob := watcher.Subscribe("Bob")
+
+	ledger.SendTransaction(ctx, "Alice", "Bob", Coin(100))
+	ledger.SendTransaction(ctx, "Alice", "Charles", Coin(200))
+	ledger.SendTransaction(ctx, "Alice", "Daniel", Coin(300))
+
+	err := watcher.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Watcher.Poll returned unexpected error %s", err)
+	}
+
+	if txn := receive(t, bob); txn.Amount != Coin(100) {
+		t.Errorf("Expected Bob's subscriber to receive 1.00, saw %v", txn)
+	}
+	if txn := receive(t, otherBob); txn.Amount != Coin(100) {
+		t.Errorf("Expected every subscriber to Bob to receive 1.00, saw %v", txn)
+	}
+	if txn := receive(t, charles); txn.Amount != Coin(200) {
+		t.Errorf("Expected Charles's subscriber to receive 2.00, saw %v", txn)
+	}
+
+	// a second poll with no new transactions delivers nothing
+	watcher.Poll(ctx)
+	select {
+	case txn := <-bob:
+		t.Errorf("Bob's subscriber unexpectedly received %v twice", txn)
+	default:
+	}
+
+	if ledger.getCalls != 2 {
+		t.Errorf("Expected one ledger download per poll, saw %d downloads", ledger.getCalls)
+	}
+}
+
+func TestWatcherUnsubscribe(t *testing.T) {
+	fmt.Println("Running TestWatcherUnsubscribe...")
+
+	watcher := NewWatcher(&testLedger{})
+	bob := watcher.Subscribe("Bob")
+
+	// nobody reads from bob, so Publish blocks once the channel is full until the
+	// subscriber goes away
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			watcher.Publish(&Transaction{time.Now(), "Alice", "Bob", Coin(1), DEFAULT_ASSET, 0})
+		}
+		close(published)
+	}()
+
+	time.Sleep(time.Duration(10) * time.Millisecond)
+	watcher.Unsubscribe("Bob", bob)
+
+	select {
+	case <-published:
+	case <-time.After(TIMEOUT):
+		t.Errorf("Watcher.Publish was still blocked after the subscriber unsubscribed")
+	}
+}